@@ -2,10 +2,41 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 	_ "github.com/mattn/go-sqlite3"
 	"log"
+	"strings"
+	"time"
 )
 
+// Dates are stored as TEXT in this format so that they sort correctly.
+const dateFormat = "2006-01-02"
+
+func today() string {
+	return time.Now().Format(dateFormat)
+}
+
+func isDate(s string) bool {
+	_, err := time.Parse(dateFormat, s)
+	return err == nil
+}
+
+// *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Returned by del functions when other rows still refer to the row being
+// deleted. Deps describes the dependents, ex. "12 transactions".
+type DependentsError struct {
+	What string
+	Deps []string
+}
+
+func (e *DependentsError) Error() string {
+	return fmt.Sprintf("%s can't be deleted because it is used by: %s", e.What, strings.Join(e.Deps, ", "))
+}
+
 func sqlstmt(db *sql.DB, s string) *sql.Stmt {
 	stmt, err := db.Prepare(s)
 	if err != nil {
@@ -30,3 +61,61 @@ func txexec(tx *sql.Tx, s string, pp ...interface{}) (sql.Result, error) {
 	defer stmt.Close()
 	return stmt.Exec(pp...)
 }
+
+// Filters tri-state boolean columns. The zero value matches any row.
+type FilterBool int
+
+const (
+	FilterAny FilterBool = iota
+	FilterTrue
+	FilterFalse
+)
+
+// Builds a parameterized WHERE clause from conditions added one at a time.
+//
+//	var w sqlWhere
+//	w.add("code = ?", code)
+//	s := "SELECT ... FROM account" + w.String()
+//	rows, err := db.Query(s, w.pp...)
+type sqlWhere struct {
+	conds []string
+	pp    []interface{}
+}
+
+func (w *sqlWhere) add(cond string, pp ...interface{}) {
+	w.conds = append(w.conds, cond)
+	w.pp = append(w.pp, pp...)
+}
+
+// Add case insensitive substring match on col.
+func (w *sqlWhere) addLike(col, substr string) {
+	r := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	w.add(col+` LIKE ? ESCAPE '\'`, "%"+r.Replace(substr)+"%")
+}
+
+func (w *sqlWhere) addBool(col string, fb FilterBool) {
+	switch fb {
+	case FilterTrue:
+		w.add(col + " <> 0")
+	case FilterFalse:
+		w.add(col + " = 0")
+	}
+}
+
+func (w *sqlWhere) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(w.conds, " AND ")
+}
+
+// Return LIMIT/OFFSET clause and its parameters. Limit 0 means no limit.
+func sqlLimit(limit, offset int) (string, []interface{}) {
+	if limit <= 0 && offset <= 0 {
+		return "", nil
+	}
+	if limit <= 0 {
+		limit = -1
+	}
+	return " LIMIT ? OFFSET ?", []interface{}{limit, offset}
+}
@@ -6,24 +6,71 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
-type AccountType int
+type Account struct {
+	Accountid     int64      `json:"accountid"`
+	Code          string     `json:"code"`
+	Name          string     `json:"name"`
+	Accounttypeid int64      `json:"accounttypeid"`
+	Currencyid    int64      `json:"currencyid"`
+	Inactive      bool       `json:"inactive"`
+	Costmethod    CostMethod `json:"costmethod"` // for accounts that track shares
+}
+
+// How sells are matched against buy lots to compute cost basis.
+type CostMethod int
 
 const (
-	BankAccount AccountType = iota
-	StockAccount
+	CostFIFO    CostMethod = iota // oldest lots sold first
+	CostLIFO                      // newest lots sold first
+	CostAverage                   // all lots pooled at average cost per share
 )
 
-type Account struct {
-	Accountid   int64       `json:"accountid"`
-	Code        string      `json:"code"`
-	Name        string      `json:"name"`
-	AccountType AccountType `json:"int"`
-	Currencyid  int64       `json:"currencyid"`
+func (cm CostMethod) String() string {
+	switch cm {
+	case CostLIFO:
+		return "LIFO"
+	case CostAverage:
+		return "Average"
+	}
+	return "FIFO"
+}
+
+type AccountOrder int
+
+const (
+	AccountOrderType AccountOrder = iota // account type, then name
+	AccountOrderName
+	AccountOrderCode
+)
+
+var accountOrderBy = map[AccountOrder]string{
+	AccountOrderType: "accounttype_id, name, account_id",
+	AccountOrderName: "name, account_id",
+	AccountOrderCode: "code, account_id",
+}
+
+// Selects accounts for findAccounts(). Zero valued fields are ignored.
+type AccountFilter struct {
+	Code          string // exact match
+	Name          string // case insensitive substring match
+	Accounttypeid int64
+	Currencyid    int64
+	Active        FilterBool
+	Order         AccountOrder
+	Limit         int
+	Offset        int
+}
+
+const accountCols = "account_id, code, name, accounttype_id, currency_id, inactive, costmethod"
+
+// Scan accountCols into a.
+func scanAccountRow(row rowScanner, a *Account) error {
+	return row.Scan(&a.Accountid, &a.Code, &a.Name, &a.Accounttypeid, &a.Currencyid, &a.Inactive, &a.Costmethod)
 }
 
 func createAccount(db *sql.DB, a *Account) (int64, error) {
-	s := "INSERT INTO account (code, name, accounttype, currency_id) VALUES (?, ?, ?, ?)"
-	result, err := sqlexec(db, s, a.Code, a.Name, a.AccountType, a.Currencyid)
+	s := "INSERT INTO account (code, name, accounttype_id, currency_id, inactive, costmethod) VALUES (?, ?, ?, ?, ?, ?)"
+	result, err := sqlexec(db, s, a.Code, a.Name, a.Accounttypeid, a.Currencyid, a.Inactive, a.Costmethod)
 	if err != nil {
 		return 0, err
 	}
@@ -34,27 +81,108 @@ func createAccount(db *sql.DB, a *Account) (int64, error) {
 	return id, nil
 }
 func editAccount(db *sql.DB, a *Account) error {
-	s := "UPDATE account SET code = ?, name = ?, accounttype = ?, currency_id = ? WHERE account_id = ?"
-	_, err := sqlexec(db, s, a.Code, a.Name, a.AccountType, a.Currencyid, a.Accountid)
+	s := "UPDATE account SET code = ?, name = ?, accounttype_id = ?, currency_id = ?, inactive = ?, costmethod = ? WHERE account_id = ?"
+	_, err := sqlexec(db, s, a.Code, a.Name, a.Accounttypeid, a.Currencyid, a.Inactive, a.Costmethod, a.Accountid)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// Delete account. Returns *DependentsError if it still has transactions,
+// use delAccountCascade() to delete them along with the account.
 func delAccount(db *sql.DB, accountid int64) error {
+	err := accountDependents(db, accountid)
+	if err != nil {
+		return err
+	}
 	s := "DELETE FROM account WHERE account_id = ?"
-	_, err := sqlexec(db, s, accountid)
+	_, err = sqlexec(db, s, accountid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Delete account and all its transactions.
+func delAccountCascade(db *sql.DB, accountid int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = txdelAccount(tx, accountid)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Transfers and journal entries involving the account lose their link,
+// their legs and postings in other accounts are kept as single-entry
+// transactions.
+func txdelAccount(tx *sql.Tx, accountid int64) error {
+	s := "DELETE FROM transfer WHERE from_trans_id IN (SELECT trans_id FROM trans WHERE account_id = ?1) OR to_trans_id IN (SELECT trans_id FROM trans WHERE account_id = ?1)"
+	_, err := txexec(tx, s, accountid)
+	if err != nil {
+		return err
+	}
+	s = "UPDATE trans SET journal_id = NULL WHERE journal_id IN (SELECT journal_id FROM trans WHERE account_id = ?)"
+	_, err = txexec(tx, s, accountid)
+	if err != nil {
+		return err
+	}
+	_, err = txexec(tx, "DELETE FROM journal WHERE NOT EXISTS (SELECT 1 FROM trans t WHERE t.journal_id = journal.journal_id)")
+	if err != nil {
+		return err
+	}
+	_, err = txexec(tx, "DELETE FROM trans WHERE account_id = ?", accountid)
+	if err != nil {
+		return err
+	}
+	_, err = txexec(tx, "DELETE FROM schedule WHERE account_id = ?", accountid)
+	if err != nil {
+		return err
+	}
+	_, err = txexec(tx, "DELETE FROM account WHERE account_id = ?", accountid)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func accountDependents(db *sql.DB, accountid int64) error {
+	var name string
+	var ntrans, nschedules int
+	s := "SELECT name, (SELECT COUNT(*) FROM trans WHERE account_id = ?1), (SELECT COUNT(*) FROM schedule WHERE account_id = ?1) FROM account WHERE account_id = ?1"
+	err := db.QueryRow(s, accountid).Scan(&name, &ntrans, &nschedules)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var deps []string
+	if ntrans > 0 {
+		deps = append(deps, fmt.Sprintf("%d transaction(s)", ntrans))
+	}
+	if nschedules > 0 {
+		deps = append(deps, fmt.Sprintf("%d schedule(s)", nschedules))
+	}
+	if len(deps) == 0 {
+		return nil
+	}
+	return &DependentsError{
+		What: fmt.Sprintf("Account '%s'", name),
+		Deps: deps,
+	}
+}
+
 func findAccount(db *sql.DB, accountid int64) (*Account, error) {
-	s := "SELECT account_id, code, name, accounttype, currency_id FROM account WHERE account_id = ?"
+	s := "SELECT " + accountCols + " FROM account WHERE account_id = ?"
 	row := db.QueryRow(s, accountid)
 	var a Account
-	err := row.Scan(&a.Accountid, &a.Code, &a.Name, &a.AccountType, &a.Currencyid)
+	err := scanAccountRow(row, &a)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -63,28 +191,120 @@ func findAccount(db *sql.DB, accountid int64) (*Account, error) {
 	}
 	return &a, nil
 }
-func findAccounts(db *sql.DB, swhere string) ([]*Account, error) {
-	s := fmt.Sprintf("SELECT account_id, code, name, accounttype, currency_id FROM account WHERE %s", swhere)
-	rows, err := db.Query(s)
+func findAccountByCode(db *sql.DB, code string) (*Account, error) {
+	aa, err := findAccounts(db, &AccountFilter{Code: code, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(aa) == 0 {
+		return nil, nil
+	}
+	return aa[0], nil
+}
+
+// Return accounts matching filter. A nil filter returns all accounts.
+func findAccounts(db *sql.DB, f *AccountFilter) ([]*Account, error) {
+	if f == nil {
+		f = &AccountFilter{}
+	}
+	var w sqlWhere
+	if f.Code != "" {
+		w.add("code = ?", f.Code)
+	}
+	if f.Name != "" {
+		w.addLike("name", f.Name)
+	}
+	if f.Accounttypeid != 0 {
+		w.add("accounttype_id = ?", f.Accounttypeid)
+	}
+	if f.Currencyid != 0 {
+		w.add("currency_id = ?", f.Currencyid)
+	}
+	w.addBool("NOT inactive", f.Active)
+	orderby, ok := accountOrderBy[f.Order]
+	if !ok {
+		return nil, fmt.Errorf("invalid account order %d", f.Order)
+	}
+	slimit, limitpp := sqlLimit(f.Limit, f.Offset)
+
+	s := "SELECT " + accountCols + " FROM account" + w.String() + " ORDER BY " + orderby + slimit
+	rows, err := db.Query(s, append(w.pp, limitpp...)...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	aa := []*Account{}
 	for rows.Next() {
 		var a Account
-		rows.Scan(&a.Accountid, &a.Code, &a.Name, &a.AccountType, &a.Currencyid)
+		err := scanAccountRow(rows, &a)
+		if err != nil {
+			return nil, err
+		}
 		aa = append(aa, &a)
 	}
-	return aa, nil
+	return aa, rows.Err()
 }
 
-func balAccount(db *sql.DB, accountid int64) float64 {
-	s := "SELECT IFNULL(SUM(amt), 0.0) FROM trans WHERE account_id = ?"
-	row := db.QueryRow(s, accountid)
-	var bal float64
-	err := row.Scan(&bal)
+func balAccount(db *sql.DB, accountid int64) Money {
+	return balAccountAsOf(db, accountid, "", "")
+}
+
+// Balance of account at the end of day asof. If startdt is given, only
+// transactions from startdt on are included, giving the change in balance
+// over the period. Blank dates leave that end of the range open.
+func balAccountAsOf(db *sql.DB, accountid int64, startdt, asof string) Money {
+	cur, err := findAccountCurrency(db, accountid)
+	if err != nil {
+		return Money{}
+	}
+	bal, err := sumTrans(db, accountid, startdt, asof)
+	if err != nil {
+		return Money{0, cur}
+	}
+	return Money{bal, cur}
+}
+
+// Sum of the reconciled transactions of an account, the balance as of its
+// last finished reconciliation.
+func balReconciled(db *sql.DB, accountid int64) Money {
+	cur, err := findAccountCurrency(db, accountid)
+	if err != nil {
+		return Money{}
+	}
+	var bal int64
+	s := "SELECT IFNULL(SUM(amt), 0) FROM trans WHERE account_id = ? AND status = ?"
+	err = db.QueryRow(s, accountid, StatusReconciled).Scan(&bal)
 	if err != nil {
-		return 0.0
+		return Money{0, cur}
 	}
-	return bal
+	return Money{bal, cur}
 }
+
+// Balance of the reconciled transactions plus the cleared ones dated up to
+// stmtdate. This is what the statement ending balance should be.
+func balCleared(db *sql.DB, accountid int64, stmtdate string) Money {
+	cur, err := findAccountCurrency(db, accountid)
+	if err != nil {
+		return Money{}
+	}
+	var bal int64
+	err = db.QueryRow(sumClearedSQL, accountid, StatusReconciled, StatusCleared, stmtdate).Scan(&bal)
+	if err != nil {
+		return Money{0, cur}
+	}
+	return Money{bal, cur}
+}
+func txbalCleared(tx *sql.Tx, accountid int64, stmtdate string) (Money, error) {
+	cur, err := txfindAccountCurrency(tx, accountid)
+	if err != nil {
+		return Money{}, err
+	}
+	var bal int64
+	err = tx.QueryRow(sumClearedSQL, accountid, StatusReconciled, StatusCleared, stmtdate).Scan(&bal)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{bal, cur}, nil
+}
+
+const sumClearedSQL = "SELECT IFNULL(SUM(amt), 0) FROM trans WHERE account_id = ? AND (status = ? OR (status = ? AND date <= ?))"
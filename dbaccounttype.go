@@ -0,0 +1,116 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//CREATE TABLE accounttype (accounttype_id INTEGER PRIMARY KEY NOT NULL, name TEXT, isshares INTEGER NOT NULL DEFAULT 0, ischeck INTEGER NOT NULL DEFAULT 0, isnominal INTEGER NOT NULL DEFAULT 0)
+
+type AccountType struct {
+	Accounttypeid int64  `json:"accounttypeid"`
+	Name          string `json:"name"`
+	Isshares      bool   `json:"isshares"`  // transactions track share quantities (stocks, funds)
+	Ischeck       bool   `json:"ischeck"`   // transactions use check numbers as ref
+	Isnominal     bool   `json:"isnominal"` // income, expense or equity, not part of net worth
+}
+
+func createAccountType(db *sql.DB, at *AccountType) (int64, error) {
+	s := "INSERT INTO accounttype (name, isshares, ischeck, isnominal) VALUES (?, ?, ?, ?)"
+	result, err := sqlexec(db, s, at.Name, at.Isshares, at.Ischeck, at.Isnominal)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+func editAccountType(db *sql.DB, at *AccountType) error {
+	s := "UPDATE accounttype SET name = ?, isshares = ?, ischeck = ?, isnominal = ? WHERE accounttype_id = ?"
+	_, err := sqlexec(db, s, at.Name, at.Isshares, at.Ischeck, at.Isnominal, at.Accounttypeid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Delete account type. Returns *DependentsError listing the accounts of
+// this type, if any.
+func delAccountType(db *sql.DB, accounttypeid int64) error {
+	at, err := findAccountType(db, accounttypeid)
+	if err != nil {
+		return err
+	}
+	if at == nil {
+		return nil
+	}
+	aa, err := findAccounts(db, &AccountFilter{Accounttypeid: accounttypeid, Order: AccountOrderName})
+	if err != nil {
+		return err
+	}
+	if len(aa) > 0 {
+		var deps []string
+		for _, a := range aa {
+			deps = append(deps, fmt.Sprintf("account '%s'", a.Name))
+		}
+		return &DependentsError{
+			What: fmt.Sprintf("Account type '%s'", at.Name),
+			Deps: deps,
+		}
+	}
+
+	s := "DELETE FROM accounttype WHERE accounttype_id = ?"
+	_, err = sqlexec(db, s, accounttypeid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func findAccountType(db *sql.DB, accounttypeid int64) (*AccountType, error) {
+	s := "SELECT accounttype_id, name, isshares, ischeck, isnominal FROM accounttype WHERE accounttype_id = ?"
+	row := db.QueryRow(s, accounttypeid)
+	var at AccountType
+	err := row.Scan(&at.Accounttypeid, &at.Name, &at.Isshares, &at.Ischeck, &at.Isnominal)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &at, nil
+}
+func findAccountTypeByName(db *sql.DB, name string) (*AccountType, error) {
+	s := "SELECT accounttype_id, name, isshares, ischeck, isnominal FROM accounttype WHERE name = ?"
+	row := db.QueryRow(s, name)
+	var at AccountType
+	err := row.Scan(&at.Accounttypeid, &at.Name, &at.Isshares, &at.Ischeck, &at.Isnominal)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &at, nil
+}
+func findAccountTypes(db *sql.DB) ([]*AccountType, error) {
+	s := "SELECT accounttype_id, name, isshares, ischeck, isnominal FROM accounttype ORDER BY accounttype_id"
+	rows, err := db.Query(s)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tt := []*AccountType{}
+	for rows.Next() {
+		var at AccountType
+		err := rows.Scan(&at.Accounttypeid, &at.Name, &at.Isshares, &at.Ischeck, &at.Isnominal)
+		if err != nil {
+			return nil, err
+		}
+		tt = append(tt, &at)
+	}
+	return tt, rows.Err()
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//CREATE TABLE budget (budget_id INTEGER PRIMARY KEY NOT NULL, category_id INTEGER NOT NULL REFERENCES category(category_id) ON DELETE CASCADE, month TEXT NOT NULL, amt INTEGER NOT NULL, currency_id INTEGER NOT NULL REFERENCES currency(currency_id), rollover INTEGER NOT NULL DEFAULT 0, UNIQUE (category_id, month))
+
+// Amount budgeted for spending in a category for a month. Spending in the
+// category's subcategories counts against it too.
+//
+// With Rollover set, whatever is left unspent at the end of the month is
+// carried into the category's budget for the following month.
+type Budget struct {
+	Budgetid   int64  `json:"budgetid"`
+	Categoryid int64  `json:"categoryid"`
+	Month      string `json:"month"` // YYYY-MM
+	Amt        int64  `json:"amt"`   // minor units of Currencyid
+	Currencyid int64  `json:"currencyid"`
+	Rollover   bool   `json:"rollover"`
+}
+
+const monthFormat = "2006-01"
+
+func isMonth(s string) bool {
+	_, err := time.Parse(monthFormat, s)
+	return err == nil
+}
+
+// Month n months after month, ex. addMonth("2024-12", 1) is "2025-01".
+func addMonth(month string, n int) string {
+	t, err := time.Parse(monthFormat, month)
+	if err != nil {
+		return ""
+	}
+	return t.AddDate(0, n, 0).Format(monthFormat)
+}
+
+// First and last dates of month.
+func monthRange(month string) (string, string) {
+	t, err := time.Parse(monthFormat, month)
+	if err != nil {
+		return "", ""
+	}
+	return t.Format(dateFormat), t.AddDate(0, 1, -1).Format(dateFormat)
+}
+
+func checkBudget(b *Budget) error {
+	if !isMonth(b.Month) {
+		return fmt.Errorf("Invalid month '%s', use YYYY-MM", b.Month)
+	}
+	if b.Amt < 0 {
+		return fmt.Errorf("Budget amount can't be negative")
+	}
+	return nil
+}
+
+// Set category's budget for the month, replacing any existing one.
+func createBudget(db *sql.DB, b *Budget) (int64, error) {
+	err := checkBudget(b)
+	if err != nil {
+		return 0, err
+	}
+	s := "INSERT INTO budget (category_id, month, amt, currency_id, rollover) VALUES (?, ?, ?, ?, ?) ON CONFLICT (category_id, month) DO UPDATE SET amt = excluded.amt, currency_id = excluded.currency_id, rollover = excluded.rollover"
+	_, err = sqlexec(db, s, b.Categoryid, b.Month, b.Amt, b.Currencyid, b.Rollover)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	s = "SELECT budget_id FROM budget WHERE category_id = ? AND month = ?"
+	err = db.QueryRow(s, b.Categoryid, b.Month).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+func editBudget(db *sql.DB, b *Budget) error {
+	err := checkBudget(b)
+	if err != nil {
+		return err
+	}
+	s := "UPDATE budget SET category_id = ?, month = ?, amt = ?, currency_id = ?, rollover = ? WHERE budget_id = ?"
+	_, err = sqlexec(db, s, b.Categoryid, b.Month, b.Amt, b.Currencyid, b.Rollover, b.Budgetid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+func delBudget(db *sql.DB, budgetid int64) error {
+	s := "DELETE FROM budget WHERE budget_id = ?"
+	_, err := sqlexec(db, s, budgetid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+const budgetCols = "budget_id, category_id, month, amt, currency_id, rollover"
+
+func scanBudgetRow(row rowScanner, b *Budget) error {
+	return row.Scan(&b.Budgetid, &b.Categoryid, &b.Month, &b.Amt, &b.Currencyid, &b.Rollover)
+}
+
+func findBudget(db *sql.DB, budgetid int64) (*Budget, error) {
+	row := db.QueryRow("SELECT "+budgetCols+" FROM budget WHERE budget_id = ?", budgetid)
+	var b Budget
+	err := scanBudgetRow(row, &b)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Category's budget for the month, or nil if it has none.
+func findCategoryBudget(db *sql.DB, categoryid int64, month string) (*Budget, error) {
+	row := db.QueryRow("SELECT "+budgetCols+" FROM budget WHERE category_id = ? AND month = ?", categoryid, month)
+	var b Budget
+	err := scanBudgetRow(row, &b)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Budgets for a month.
+func findBudgets(db *sql.DB, month string) ([]*Budget, error) {
+	rows, err := db.Query("SELECT "+budgetCols+" FROM budget WHERE month = ? ORDER BY category_id", month)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	bb := []*Budget{}
+	for rows.Next() {
+		var b Budget
+		err := scanBudgetRow(rows, &b)
+		if err != nil {
+			return nil, err
+		}
+		bb = append(bb, &b)
+	}
+	return bb, rows.Err()
+}
+
+// Copy the budgets of month from to month to, skipping categories already
+// budgeted in month to. Returns the number copied.
+func copyBudgets(db *sql.DB, from, to string) (int, error) {
+	if !isMonth(from) {
+		return 0, fmt.Errorf("Invalid month '%s', use YYYY-MM", from)
+	}
+	if !isMonth(to) {
+		return 0, fmt.Errorf("Invalid month '%s', use YYYY-MM", to)
+	}
+	s := `INSERT INTO budget (category_id, month, amt, currency_id, rollover)
+SELECT category_id, ?1, amt, currency_id, rollover FROM budget b WHERE month = ?2
+AND NOT EXISTS (SELECT 1 FROM budget WHERE category_id = b.category_id AND month = ?1)`
+	result, err := sqlexec(db, s, to, from)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), nil
+}
+
+// Budget compared with actual spending for the month. Available is the
+// budgeted amount plus what was carried over from the previous month, and
+// Remaining is Available less Actual (negative when overspent).
+type BudgetStatus struct {
+	Budget    *Budget   `json:"budget"`
+	Category  *Category `json:"category"`
+	Budgeted  Money     `json:"budgeted"`
+	Carried   Money     `json:"carried"`
+	Available Money     `json:"available"`
+	Actual    Money     `json:"actual"`
+	Remaining Money     `json:"remaining"`
+}
+
+// Budget versus actual spending for each category budgeted in month, in
+// category path order. Spending is the negated total of the category's
+// transactions in the month, including its subcategories', converted to the
+// budget's currency at the rate on each transaction's date.
+func findBudgetStatus(db *sql.DB, month string) ([]*BudgetStatus, error) {
+	if !isMonth(month) {
+		return nil, fmt.Errorf("Invalid month '%s', use YYYY-MM", month)
+	}
+	cc, err := findCategories(db)
+	if err != nil {
+		return nil, err
+	}
+	cv, err := newConverter(db)
+	if err != nil {
+		return nil, err
+	}
+
+	// Category totals are cached per month and currency since every rollover
+	// chain walks back through the same months.
+	sums := map[string]map[int64]Money{}
+	actual := func(b *Budget) (Money, error) {
+		cur := cv.curs[b.Currencyid]
+		k := fmt.Sprintf("%s/%d", b.Month, b.Currencyid)
+		tots, ok := sums[k]
+		if !ok {
+			startdt, enddt := monthRange(b.Month)
+			var err error
+			tots, err = categorySums(db, cc, cv, cur, startdt, enddt)
+			if err != nil {
+				return Money{}, err
+			}
+			sums[k] = tots
+		}
+		if tot, ok := tots[b.Categoryid]; ok {
+			return tot.Neg(), nil
+		}
+		return Money{0, cur}, nil
+	}
+
+	bb, err := findBudgets(db, month)
+	if err != nil {
+		return nil, err
+	}
+	byid := map[int64]*BudgetStatus{}
+	for _, b := range bb {
+		chain, err := rolloverChain(db, b)
+		if err != nil {
+			return nil, err
+		}
+		var bs *BudgetStatus
+		var carry int64
+		for _, cb := range chain {
+			spent, err := actual(cb)
+			if err != nil {
+				return nil, err
+			}
+			cur := cv.curs[cb.Currencyid]
+			bs = &BudgetStatus{
+				Budget:    cb,
+				Budgeted:  Money{cb.Amt, cur},
+				Carried:   Money{carry, cur},
+				Available: Money{cb.Amt + carry, cur},
+				Actual:    spent,
+			}
+			bs.Remaining = bs.Available.Sub(spent)
+			carry = 0
+			if cb.Rollover && bs.Remaining.Units > 0 {
+				carry = bs.Remaining.Units
+			}
+		}
+		byid[b.Categoryid] = bs
+	}
+
+	bss := []*BudgetStatus{}
+	for _, c := range cc {
+		if bs, ok := byid[c.Categoryid]; ok {
+			bs.Category = c
+			bss = append(bss, bs)
+		}
+	}
+	return bss, nil
+}
+
+// Budget b preceded by the category's budgets of the months immediately
+// before it, oldest first, going back as long as each one rolls over into
+// the next in the same currency.
+func rolloverChain(db *sql.DB, b *Budget) ([]*Budget, error) {
+	chain := []*Budget{b}
+	for {
+		prev, err := findCategoryBudget(db, b.Categoryid, addMonth(chain[0].Month, -1))
+		if err != nil {
+			return nil, err
+		}
+		if prev == nil || !prev.Rollover || prev.Currencyid != b.Currencyid {
+			break
+		}
+		chain = append([]*Budget{prev}, chain...)
+	}
+	return chain, nil
+}
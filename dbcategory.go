@@ -0,0 +1,308 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//CREATE TABLE category (category_id INTEGER PRIMARY KEY NOT NULL, parent_id INTEGER REFERENCES category(category_id), name TEXT NOT NULL)
+
+// Categories form a tree. Path is the names from the top level category
+// down, separated by ':', ex. "Food:Groceries". It is computed, not stored.
+type Category struct {
+	Categoryid int64  `json:"categoryid"`
+	Parentid   int64  `json:"parentid"` // 0 for top level
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+}
+
+const categorySep = ":"
+
+func checkCategoryName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("Category name is blank")
+	}
+	if strings.Contains(name, categorySep) {
+		return fmt.Errorf("Category name '%s' can't contain '%s'", name, categorySep)
+	}
+	return nil
+}
+
+func createCategory(db *sql.DB, c *Category) (int64, error) {
+	err := checkCategoryName(c.Name)
+	if err != nil {
+		return 0, err
+	}
+	s := "INSERT INTO category (parent_id, name) VALUES (NULLIF(?, 0), ?)"
+	result, err := sqlexec(db, s, c.Parentid, c.Name)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Find category by path, creating it and any missing parents.
+func createCategoryPath(db *sql.DB, path string) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	id, err := txcreateCategoryPath(tx, path)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+func txcreateCategoryPath(tx *sql.Tx, path string) (int64, error) {
+	var parentid int64
+	for _, name := range strings.Split(path, categorySep) {
+		name = strings.TrimSpace(name)
+		err := checkCategoryName(name)
+		if err != nil {
+			return 0, err
+		}
+		var id int64
+		s := "SELECT category_id FROM category WHERE IFNULL(parent_id, 0) = ? AND name = ?"
+		err = tx.QueryRow(s, parentid, name).Scan(&id)
+		if err == sql.ErrNoRows {
+			result, err := txexec(tx, "INSERT INTO category (parent_id, name) VALUES (NULLIF(?, 0), ?)", parentid, name)
+			if err != nil {
+				return 0, err
+			}
+			id, err = result.LastInsertId()
+			if err != nil {
+				return 0, err
+			}
+		} else if err != nil {
+			return 0, err
+		}
+		parentid = id
+	}
+	return parentid, nil
+}
+
+// Update category. A category can't be moved under itself or one of its
+// subcategories.
+func editCategory(db *sql.DB, c *Category) error {
+	err := checkCategoryName(c.Name)
+	if err != nil {
+		return err
+	}
+	if c.Parentid != 0 {
+		var n int
+		s := `WITH RECURSIVE sub(category_id) AS (SELECT ? UNION ALL SELECT c.category_id FROM category c INNER JOIN sub ON c.parent_id = sub.category_id)
+SELECT COUNT(*) FROM sub WHERE category_id = ?`
+		err := db.QueryRow(s, c.Categoryid, c.Parentid).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("Category '%s' can't be moved under itself", c.Name)
+		}
+	}
+	s := "UPDATE category SET parent_id = NULLIF(?, 0), name = ? WHERE category_id = ?"
+	_, err = sqlexec(db, s, c.Parentid, c.Name, c.Categoryid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Delete category and its budgets. Returns *DependentsError if it has
+// subcategories, transactions or schedules.
+func delCategory(db *sql.DB, categoryid int64) error {
+	c, err := findCategory(db, categoryid)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return nil
+	}
+	var nsub, ntrans, nschedules int
+	s := "SELECT (SELECT COUNT(*) FROM category WHERE parent_id = ?1), (SELECT COUNT(*) FROM trans WHERE category_id = ?1), (SELECT COUNT(*) FROM schedule WHERE category_id = ?1)"
+	err = db.QueryRow(s, categoryid).Scan(&nsub, &ntrans, &nschedules)
+	if err != nil {
+		return err
+	}
+	var deps []string
+	if nsub > 0 {
+		deps = append(deps, fmt.Sprintf("%d subcategory(s)", nsub))
+	}
+	if ntrans > 0 {
+		deps = append(deps, fmt.Sprintf("%d transaction(s)", ntrans))
+	}
+	if nschedules > 0 {
+		deps = append(deps, fmt.Sprintf("%d schedule(s)", nschedules))
+	}
+	if len(deps) > 0 {
+		return &DependentsError{
+			What: fmt.Sprintf("Category '%s'", c.Path),
+			Deps: deps,
+		}
+	}
+
+	s = "DELETE FROM category WHERE category_id = ?"
+	_, err = sqlexec(db, s, categoryid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// All categories with their paths, in path order so that subcategories
+// follow their parent.
+const categoryTree = `WITH RECURSIVE tree(category_id, parent_id, name, path) AS (
+SELECT category_id, IFNULL(parent_id, 0), name, name FROM category WHERE parent_id IS NULL
+UNION ALL
+SELECT c.category_id, c.parent_id, c.name, tree.path || ':' || c.name FROM category c INNER JOIN tree ON c.parent_id = tree.category_id)
+SELECT category_id, parent_id, name, path FROM tree`
+
+func findCategory(db *sql.DB, categoryid int64) (*Category, error) {
+	row := db.QueryRow(categoryTree+" WHERE category_id = ?", categoryid)
+	var c Category
+	err := row.Scan(&c.Categoryid, &c.Parentid, &c.Name, &c.Path)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Find category by path, ex. "Food:Groceries".
+func findCategoryByPath(db *sql.DB, path string) (*Category, error) {
+	var names []string
+	for _, name := range strings.Split(path, categorySep) {
+		names = append(names, strings.TrimSpace(name))
+	}
+	row := db.QueryRow(categoryTree+" WHERE path = ?", strings.Join(names, categorySep))
+	var c Category
+	err := row.Scan(&c.Categoryid, &c.Parentid, &c.Name, &c.Path)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func findCategories(db *sql.DB) ([]*Category, error) {
+	rows, err := db.Query(categoryTree + " ORDER BY path")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	cc := []*Category{}
+	for rows.Next() {
+		var c Category
+		err := rows.Scan(&c.Categoryid, &c.Parentid, &c.Name, &c.Path)
+		if err != nil {
+			return nil, err
+		}
+		cc = append(cc, &c)
+	}
+	return cc, rows.Err()
+}
+
+// Depth of category in the tree, 0 for top level.
+func (c *Category) Depth() int {
+	return strings.Count(c.Path, categorySep)
+}
+
+// Total of a category's transactions, including its subcategories'.
+type CategoryTotal struct {
+	Category *Category `json:"category"`
+	Amt      Money     `json:"amt"`
+}
+
+// Totals of transactions dated from startdt to enddt (blank for open
+// ended) by category, in currency repcur at the rate on each transaction's
+// date. Every category with transactions in its subtree is listed, in path
+// order. Transactions without a category aren't counted.
+func findCategoryTotals(db *sql.DB, repcur *Currency, startdt, enddt string) ([]*CategoryTotal, error) {
+	cc, err := findCategories(db)
+	if err != nil {
+		return nil, err
+	}
+	cv, err := newConverter(db)
+	if err != nil {
+		return nil, err
+	}
+	tots, err := categorySums(db, cc, cv, repcur, startdt, enddt)
+	if err != nil {
+		return nil, err
+	}
+
+	ctt := []*CategoryTotal{}
+	for _, c := range cc {
+		if tot, ok := tots[c.Categoryid]; ok {
+			ctt = append(ctt, &CategoryTotal{c, tot})
+		}
+	}
+	return ctt, nil
+}
+
+// Map of category id to the total of its subtree's transactions dated from
+// startdt to enddt, in currency repcur at the rate on each transaction's
+// date. Categories without transactions in their subtree aren't in the map.
+func categorySums(db *sql.DB, cc []*Category, cv *Converter, repcur *Currency, startdt, enddt string) (map[int64]Money, error) {
+	s := `SELECT t.category_id, a.currency_id, t.date, SUM(t.amt) FROM trans t INNER JOIN account a ON a.account_id = t.account_id
+WHERE t.category_id IS NOT NULL AND (?1 = '' OR t.date >= ?1) AND (?2 = '' OR t.date <= ?2)
+GROUP BY t.category_id, a.currency_id, t.date`
+	rows, err := db.Query(s, startdt, enddt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	own := map[int64]Money{}
+	for rows.Next() {
+		var categoryid, currencyid, sum int64
+		var date string
+		err := rows.Scan(&categoryid, &currencyid, &date, &sum)
+		if err != nil {
+			return nil, err
+		}
+		m, err := cv.ConvertAsOf(Money{sum, cv.curs[currencyid]}, repcur, date)
+		if err != nil {
+			return nil, err
+		}
+		if tot, ok := own[categoryid]; ok {
+			m = m.Add(tot)
+		}
+		own[categoryid] = m
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Add each category's own total to it and all its parents.
+	parents := map[int64]int64{}
+	for _, c := range cc {
+		parents[c.Categoryid] = c.Parentid
+	}
+	tots := map[int64]Money{}
+	for id, m := range own {
+		for ; id != 0; id = parents[id] {
+			if tot, ok := tots[id]; ok {
+				tots[id] = tot.Add(m)
+			} else {
+				tots[id] = m
+			}
+		}
+	}
+	return tots, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+	"strconv"
+)
+
+// Converts money between currencies. A currency's USD rate is the number
+// of units of that currency per 1 USD, so conversion goes through USD:
+//
+//	to = from / from_rate * to_rate
+//
+// Convert() uses the current rates (Currency.Usdrate) and ConvertAsOf() the
+// rates in effect on a date, from the rate history.
+//
+// Results are rounded half to even, which keeps sums of many converted
+// amounts unbiased.
+type Converter struct {
+	db    *sql.DB
+	curs  map[int64]*Currency
+	rates map[rateKey]float64 // cache of rateAsOf() lookups
+}
+
+type rateKey struct {
+	currencyid int64
+	date       string
+}
+
+func newConverter(db *sql.DB) (*Converter, error) {
+	cc, err := findCurrencies(db, nil)
+	if err != nil {
+		return nil, err
+	}
+	cv := Converter{
+		db:    db,
+		curs:  map[int64]*Currency{},
+		rates: map[rateKey]float64{},
+	}
+	for _, c := range cc {
+		cv.curs[c.Currencyid] = c
+	}
+	return &cv, nil
+}
+
+// Rate as an exact rational of the decimal the user entered, ex. 48.5
+func ratFromRate(rate float64) *big.Rat {
+	r, _ := new(big.Rat).SetString(strconv.FormatFloat(rate, 'g', -1, 64))
+	return r
+}
+
+func (cv *Converter) Convert(m Money, to *Currency) (Money, error) {
+	return cv.ConvertAsOf(m, to, "")
+}
+
+// Convert using the rates in effect on date. Blank date uses current rates.
+func (cv *Converter) ConvertAsOf(m Money, to *Currency, date string) (Money, error) {
+	if m.Cur == nil {
+		return Money{}, fmt.Errorf("can't convert amount %s with no currency", m)
+	}
+	if m.Cur.Currencyid == to.Currencyid {
+		return Money{m.Units, to}, nil
+	}
+	fromrate, err := cv.rate(m.Cur, date)
+	if err != nil {
+		return Money{}, err
+	}
+	torate, err := cv.rate(to, date)
+	if err != nil {
+		return Money{}, err
+	}
+
+	r := new(big.Rat).Quo(ratFromRate(torate), ratFromRate(fromrate))
+	return moneyFromRat(r.Mul(r, m.Rat()), to, RoundHalfEven), nil
+}
+
+func (cv *Converter) rate(c *Currency, date string) (float64, error) {
+	var rate float64
+	if date == "" {
+		rate = c.Usdrate
+		if cached, ok := cv.curs[c.Currencyid]; ok {
+			rate = cached.Usdrate
+		}
+	} else {
+		k := rateKey{c.Currencyid, date}
+		cached, ok := cv.rates[k]
+		if !ok {
+			var err error
+			cached, err = rateAsOf(cv.db, c.Currencyid, date)
+			if err != nil {
+				return 0.0, err
+			}
+			cv.rates[k] = cached
+		}
+		rate = cached
+	}
+	if rate <= 0 {
+		return 0.0, fmt.Errorf("currency '%s' has no USD rate", c.Name)
+	}
+	return rate, nil
+}
+
+// Sum amounts in any currencies into currency to.
+func (cv *Converter) Sum(mm []Money, to *Currency) (Money, error) {
+	tot := Money{0, to}
+	for _, m := range mm {
+		cm, err := cv.Convert(m, to)
+		if err != nil {
+			return Money{}, err
+		}
+		tot = tot.Add(cm)
+	}
+	return tot, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"database/sql"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//CREATE TABLE csvmapping (account_id INTEGER PRIMARY KEY NOT NULL REFERENCES account(account_id) ON DELETE CASCADE, datecol TEXT NOT NULL DEFAULT '', refcol TEXT NOT NULL DEFAULT '', desccol TEXT NOT NULL DEFAULT '', amtcol TEXT NOT NULL DEFAULT '', debitcol TEXT NOT NULL DEFAULT '', creditcol TEXT NOT NULL DEFAULT '', dateformat TEXT NOT NULL DEFAULT '', decimalsep TEXT NOT NULL DEFAULT '', delimiter TEXT NOT NULL DEFAULT '', skip INTEGER NOT NULL DEFAULT 0, header INTEGER NOT NULL DEFAULT 0)
+
+// How the columns of an account's CSV bank export map onto transaction
+// fields. Columns are given by 1-based number, ex. "3", or by heading
+// name when the file has a header row.
+//
+// The amount is either in one signed Amtcol, or split into Debitcol
+// (money out) and Creditcol (money in).
+type CSVMapping struct {
+	Accountid  int64  `json:"accountid"`
+	Datecol    string `json:"datecol"`
+	Refcol     string `json:"refcol"` // optional
+	Desccol    string `json:"desccol"`
+	Amtcol     string `json:"amtcol"`
+	Debitcol   string `json:"debitcol"`
+	Creditcol  string `json:"creditcol"`
+	Dateformat string `json:"dateformat"` // ex. "MM/DD/YYYY"
+	Decimalsep string `json:"decimalsep"` // "." or ","
+	Delimiter  string `json:"delimiter"`  // field separator, ex. "," or ";"
+	Skip       int    `json:"skip"`       // lines to skip before the header or first row
+	Header     bool   `json:"header"`     // first line after Skip has the column headings
+}
+
+// Mapping used when an account has none saved: date, description and
+// amount in the first three columns.
+func defaultCSVMapping(accountid int64) *CSVMapping {
+	return &CSVMapping{
+		Accountid:  accountid,
+		Datecol:    "1",
+		Desccol:    "2",
+		Amtcol:     "3",
+		Dateformat: "YYYY-MM-DD",
+		Decimalsep: ".",
+		Delimiter:  ",",
+	}
+}
+
+// Save account's mapping, replacing any saved before.
+func saveCSVMapping(db *sql.DB, m *CSVMapping) error {
+	err := checkCSVMapping(m)
+	if err != nil {
+		return err
+	}
+	s := `INSERT OR REPLACE INTO csvmapping (account_id, datecol, refcol, desccol, amtcol, debitcol, creditcol, dateformat, decimalsep, delimiter, skip, header)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = sqlexec(db, s, m.Accountid, m.Datecol, m.Refcol, m.Desccol, m.Amtcol, m.Debitcol, m.Creditcol, m.Dateformat, m.Decimalsep, m.Delimiter, m.Skip, m.Header)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+func delCSVMapping(db *sql.DB, accountid int64) error {
+	s := "DELETE FROM csvmapping WHERE account_id = ?"
+	_, err := sqlexec(db, s, accountid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Account's saved mapping, or nil if it has none.
+func findCSVMapping(db *sql.DB, accountid int64) (*CSVMapping, error) {
+	s := "SELECT account_id, datecol, refcol, desccol, amtcol, debitcol, creditcol, dateformat, decimalsep, delimiter, skip, header FROM csvmapping WHERE account_id = ?"
+	row := db.QueryRow(s, accountid)
+	var m CSVMapping
+	err := row.Scan(&m.Accountid, &m.Datecol, &m.Refcol, &m.Desccol, &m.Amtcol, &m.Debitcol, &m.Creditcol, &m.Dateformat, &m.Decimalsep, &m.Delimiter, &m.Skip, &m.Header)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
@@ -3,51 +3,214 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+
 	_ "github.com/mattn/go-sqlite3"
 )
 
-//CREATE TABLE currency (currency_id INTEGER PRIMARY KEY NOT NULL, name TEXT, usdrate REAL)
+//CREATE TABLE currency (currency_id INTEGER PRIMARY KEY NOT NULL, name TEXT, usdrate REAL, decimals INTEGER NOT NULL DEFAULT 2)
 
 type Currency struct {
 	Currencyid int64   `json:"currencyid"`
 	Name       string  `json:"name"`
 	Usdrate    float64 `json:"usdrate"`
+	Decimals   int     `json:"decimals"` // digits in the minor unit, ex. 2 for cents
 }
 
+type CurrencyOrder int
+
+const (
+	CurrencyOrderName CurrencyOrder = iota
+	CurrencyOrderId                 // order created
+)
+
+var currencyOrderBy = map[CurrencyOrder]string{
+	CurrencyOrderName: "name, currency_id",
+	CurrencyOrderId:   "currency_id",
+}
+
+// Selects currencies for findCurrencies(). Zero valued fields are ignored.
+type CurrencyFilter struct {
+	Name   string // case insensitive substring match
+	Order  CurrencyOrder
+	Limit  int
+	Offset int
+}
+
+// Create currency and start its rate history with Usdrate as of today.
 func createCurrency(db *sql.DB, c *Currency) (int64, error) {
-	s := "INSERT INTO currency (name, usdrate) VALUES (?, ?)"
-	result, err := sqlexec(db, s, c.Name, c.Usdrate)
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	s := "INSERT INTO currency (name, usdrate, decimals) VALUES (?, ?, ?)"
+	result, err := txexec(tx, s, c.Name, c.Usdrate, c.Decimals)
 	if err != nil {
+		tx.Rollback()
 		return 0, err
 	}
 	id, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	_, err = txcreateCurrencyRate(tx, &CurrencyRate{Currencyid: id, Date: today(), Rate: c.Usdrate})
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	err = tx.Commit()
 	if err != nil {
 		return 0, err
 	}
 	return id, nil
 }
+
+// Update currency. A changed Usdrate is added to the rate history as of
+// today rather than replacing earlier rates. Decimals can't be changed
+// while accounts or budgets use the currency, since their amounts are
+// stored in minor units.
 func editCurrency(db *sql.DB, c *Currency) error {
-	s := "UPDATE currency SET name = ?, usdrate = ? WHERE currency_id = ?"
-	_, err := sqlexec(db, s, c.Name, c.Usdrate, c.Currencyid)
+	old, err := findCurrency(db, c.Currencyid)
 	if err != nil {
 		return err
 	}
-	return nil
+	if old != nil && old.Decimals != c.Decimals {
+		err := currencyDependents(db, c.Currencyid)
+		if de, ok := err.(*DependentsError); ok {
+			return fmt.Errorf("Decimals of currency '%s' can't be changed because it is used by: %s", old.Name, strings.Join(de.Deps, ", "))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	var oldrate float64
+	err = tx.QueryRow("SELECT usdrate FROM currency WHERE currency_id = ?", c.Currencyid).Scan(&oldrate)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	s := "UPDATE currency SET name = ?, usdrate = ?, decimals = ? WHERE currency_id = ?"
+	_, err = txexec(tx, s, c.Name, c.Usdrate, c.Decimals, c.Currencyid)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if c.Usdrate != oldrate {
+		_, err = txcreateCurrencyRate(tx, &CurrencyRate{Currencyid: c.Currencyid, Date: today(), Rate: c.Usdrate})
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
 }
+
+// Delete currency. Returns *DependentsError listing the accounts that use
+// it, use delCurrencyCascade() to delete them along with the currency.
 func delCurrency(db *sql.DB, currencyid int64) error {
+	err := currencyDependents(db, currencyid)
+	if err != nil {
+		return err
+	}
 	s := "DELETE FROM currency WHERE currency_id = ?"
-	_, err := sqlexec(db, s, currencyid)
+	_, err = sqlexec(db, s, currencyid)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// Delete currency, the accounts using it and their transactions, and the
+// budgets in it.
+func delCurrencyCascade(db *sql.DB, currencyid int64) error {
+	aa, err := findAccounts(db, &AccountFilter{Currencyid: currencyid})
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, a := range aa {
+		err := txdelAccount(tx, a.Accountid)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	_, err = txexec(tx, "DELETE FROM budget WHERE currency_id = ?", currencyid)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = txexec(tx, "DELETE FROM currency WHERE currency_id = ?", currencyid)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func currencyDependents(db *sql.DB, currencyid int64) error {
+	c, err := findCurrency(db, currencyid)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return nil
+	}
+	aa, err := findAccounts(db, &AccountFilter{Currencyid: currencyid, Order: AccountOrderName})
+	if err != nil {
+		return err
+	}
+	var nbudgets int
+	err = db.QueryRow("SELECT COUNT(*) FROM budget WHERE currency_id = ?", currencyid).Scan(&nbudgets)
+	if err != nil {
+		return err
+	}
+	if len(aa) == 0 && nbudgets == 0 {
+		return nil
+	}
+	var deps []string
+	for _, a := range aa {
+		deps = append(deps, fmt.Sprintf("account '%s'", a.Name))
+	}
+	if nbudgets > 0 {
+		deps = append(deps, fmt.Sprintf("%d budget(s)", nbudgets))
+	}
+	return &DependentsError{
+		What: fmt.Sprintf("Currency '%s'", c.Name),
+		Deps: deps,
+	}
+}
+
 func findCurrency(db *sql.DB, currencyid int64) (*Currency, error) {
-	s := "SELECT currency_id, name, usdrate, FROM currency WHERE currency_id = ?"
+	s := "SELECT currency_id, name, usdrate, decimals FROM currency WHERE currency_id = ?"
 	row := db.QueryRow(s, currencyid)
 	var c Currency
-	err := row.Scan(&c.Currencyid, &c.Name, &c.Usdrate)
+	err := row.Scan(&c.Currencyid, &c.Name, &c.Usdrate, &c.Decimals)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Currency of an account's amounts.
+func findAccountCurrency(db *sql.DB, accountid int64) (*Currency, error) {
+	s := "SELECT c.currency_id, c.name, c.usdrate, c.decimals FROM currency c INNER JOIN account a ON a.currency_id = c.currency_id WHERE a.account_id = ?"
+	row := db.QueryRow(s, accountid)
+	var c Currency
+	err := row.Scan(&c.Currencyid, &c.Name, &c.Usdrate, &c.Decimals)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -56,17 +219,64 @@ func findCurrency(db *sql.DB, currencyid int64) (*Currency, error) {
 	}
 	return &c, nil
 }
-func findCurrencies(db *sql.DB, swhere string) ([]*Currency, error) {
-	s := fmt.Sprintf("SELECT currency_id, name, usdrate FROM currency WHERE %s", swhere)
-	rows, err := db.Query(s)
+func txfindAccountCurrency(tx *sql.Tx, accountid int64) (*Currency, error) {
+	s := "SELECT c.currency_id, c.name, c.usdrate, c.decimals FROM currency c INNER JOIN account a ON a.currency_id = c.currency_id WHERE a.account_id = ?"
+	row := tx.QueryRow(s, accountid)
+	var c Currency
+	err := row.Scan(&c.Currencyid, &c.Name, &c.Usdrate, &c.Decimals)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Find currency by exact name, ex. "USD".
+func findCurrencyByName(db *sql.DB, name string) (*Currency, error) {
+	s := "SELECT currency_id, name, usdrate, decimals FROM currency WHERE name = ? ORDER BY currency_id LIMIT 1"
+	row := db.QueryRow(s, name)
+	var c Currency
+	err := row.Scan(&c.Currencyid, &c.Name, &c.Usdrate, &c.Decimals)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Return currencies matching filter. A nil filter returns all currencies.
+func findCurrencies(db *sql.DB, f *CurrencyFilter) ([]*Currency, error) {
+	if f == nil {
+		f = &CurrencyFilter{}
+	}
+	var w sqlWhere
+	if f.Name != "" {
+		w.addLike("name", f.Name)
+	}
+	orderby, ok := currencyOrderBy[f.Order]
+	if !ok {
+		return nil, fmt.Errorf("invalid currency order %d", f.Order)
+	}
+	slimit, limitpp := sqlLimit(f.Limit, f.Offset)
+
+	s := "SELECT currency_id, name, usdrate, decimals FROM currency" + w.String() + " ORDER BY " + orderby + slimit
+	rows, err := db.Query(s, append(w.pp, limitpp...)...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	cc := []*Currency{}
 	for rows.Next() {
 		var c Currency
-		rows.Scan(&c.Currencyid, &c.Name, &c.Usdrate)
+		err := rows.Scan(&c.Currencyid, &c.Name, &c.Usdrate, &c.Decimals)
+		if err != nil {
+			return nil, err
+		}
 		cc = append(cc, &c)
 	}
-	return cc, nil
+	return cc, rows.Err()
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEditCurrencyDecimals(t *testing.T) {
+	db := openTestDB(t)
+	unused, err := createCurrency(db, &Currency{Name: "JPY", Usdrate: 150, Decimals: 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		currencyid int64
+		edit       func(c *Currency)
+		wanterr    string // substring of the error, "" for none
+	}{
+		{"used currency, decimals changed", 1,
+			func(c *Currency) { c.Decimals = 3 }, "can't be changed because it is used by: account"},
+		{"used currency, other fields changed", 1,
+			func(c *Currency) { c.Usdrate = 1.5 }, ""},
+		{"unused currency, decimals changed", unused,
+			func(c *Currency) { c.Decimals = 2 }, ""},
+	}
+	for _, tt := range tests {
+		c, err := findCurrency(db, tt.currencyid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := *c
+		tt.edit(&want)
+		err = editCurrency(db, &want)
+		if tt.wanterr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wanterr) {
+				t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.wanterr)
+			}
+			want = *c
+		} else if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		got, err := findCurrency(db, tt.currencyid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != want {
+			t.Errorf("%s: currency is %+v, want %+v", tt.name, *got, want)
+		}
+	}
+}
+
+func TestFindCurrencies(t *testing.T) {
+	db := openTestDB(t)
+	for _, name := range []string{"EUR", "AUD"} {
+		_, err := createCurrency(db, &Currency{Name: name, Usdrate: 1, Decimals: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		f    *CurrencyFilter
+		want []string
+	}{
+		{nil, []string{"AUD", "EUR", "PHP", "USD"}},
+		{&CurrencyFilter{Order: CurrencyOrderId}, []string{"USD", "PHP", "EUR", "AUD"}},
+		{&CurrencyFilter{Name: "u"}, []string{"AUD", "EUR", "USD"}},
+		{&CurrencyFilter{Name: "UR"}, []string{"EUR"}},
+		{&CurrencyFilter{Name: "%"}, []string{}},
+		{&CurrencyFilter{Limit: 2, Offset: 1}, []string{"EUR", "PHP"}},
+	}
+	for _, tt := range tests {
+		cc, err := findCurrencies(db, tt.f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, c := range cc {
+			got = append(got, c.Name)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("findCurrencies(%+v) = %v, want %v", tt.f, got, tt.want)
+		}
+	}
+
+	_, err := findCurrencies(db, &CurrencyFilter{Order: 9})
+	if err == nil {
+		t.Errorf("findCurrencies with order 9: want error")
+	}
+	c, err := findCurrencyByName(db, "US")
+	if err != nil || c != nil {
+		t.Errorf("findCurrencyByName(US) = %v, %v, want no currency", c, err)
+	}
+	c, err = findCurrencyByName(db, "USD")
+	if err != nil || c == nil || c.Name != "USD" {
+		t.Errorf("findCurrencyByName(USD) = %v, %v, want USD", c, err)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//CREATE TABLE currencyrate (currencyrate_id INTEGER PRIMARY KEY NOT NULL, currency_id INTEGER NOT NULL REFERENCES currency(currency_id) ON DELETE CASCADE, date TEXT NOT NULL, rate REAL NOT NULL, UNIQUE (currency_id, date))
+
+// USD rate of a currency effective from Date until the next rate's date.
+// Currency.Usdrate always holds the latest rate.
+type CurrencyRate struct {
+	Currencyrateid int64   `json:"currencyrateid"`
+	Currencyid     int64   `json:"currencyid"`
+	Date           string  `json:"date"`
+	Rate           float64 `json:"rate"`
+}
+
+// Add rate to history, replacing any rate of the same currency and date.
+func createCurrencyRate(db *sql.DB, cr *CurrencyRate) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	id, err := txcreateCurrencyRate(tx, cr)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+func txcreateCurrencyRate(tx *sql.Tx, cr *CurrencyRate) (int64, error) {
+	s := "INSERT INTO currencyrate (currency_id, date, rate) VALUES (?, ?, ?) ON CONFLICT (currency_id, date) DO UPDATE SET rate = excluded.rate"
+	_, err := txexec(tx, s, cr.Currencyid, cr.Date, cr.Rate)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	s = "SELECT currencyrate_id FROM currencyrate WHERE currency_id = ? AND date = ?"
+	err = tx.QueryRow(s, cr.Currencyid, cr.Date).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	err = txsyncUsdrate(tx, cr.Currencyid)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Update rate. If it moves to another currency, both currencies' usdrate
+// are synced.
+func editCurrencyRate(db *sql.DB, cr *CurrencyRate) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	var oldcurrencyid int64
+	err = tx.QueryRow("SELECT currency_id FROM currencyrate WHERE currencyrate_id = ?", cr.Currencyrateid).Scan(&oldcurrencyid)
+	if err == nil {
+		s := "UPDATE currencyrate SET currency_id = ?, date = ?, rate = ? WHERE currencyrate_id = ?"
+		_, err = txexec(tx, s, cr.Currencyid, cr.Date, cr.Rate, cr.Currencyrateid)
+	}
+	if err == nil {
+		err = txsyncUsdrate(tx, cr.Currencyid)
+	}
+	if err == nil && oldcurrencyid != cr.Currencyid {
+		err = txsyncUsdrate(tx, oldcurrencyid)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+func delCurrencyRate(db *sql.DB, currencyrateid int64) error {
+	cr, err := findCurrencyRate(db, currencyrateid)
+	if err != nil {
+		return err
+	}
+	if cr == nil {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	_, err = txexec(tx, "DELETE FROM currencyrate WHERE currencyrate_id = ?", currencyrateid)
+	if err == nil {
+		err = txsyncUsdrate(tx, cr.Currencyid)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Set currency.usdrate to the latest rate in history, if any.
+func txsyncUsdrate(tx *sql.Tx, currencyid int64) error {
+	s := "UPDATE currency SET usdrate = (SELECT rate FROM currencyrate WHERE currency_id = ? ORDER BY date DESC LIMIT 1) WHERE currency_id = ? AND EXISTS (SELECT 1 FROM currencyrate WHERE currency_id = ?)"
+	_, err := txexec(tx, s, currencyid, currencyid, currencyid)
+	return err
+}
+
+func findCurrencyRate(db *sql.DB, currencyrateid int64) (*CurrencyRate, error) {
+	s := "SELECT currencyrate_id, currency_id, date, rate FROM currencyrate WHERE currencyrate_id = ?"
+	row := db.QueryRow(s, currencyrateid)
+	var cr CurrencyRate
+	err := row.Scan(&cr.Currencyrateid, &cr.Currencyid, &cr.Date, &cr.Rate)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cr, nil
+}
+
+// Rate history of a currency, oldest first.
+func findCurrencyRates(db *sql.DB, currencyid int64) ([]*CurrencyRate, error) {
+	s := "SELECT currencyrate_id, currency_id, date, rate FROM currencyrate WHERE currency_id = ? ORDER BY date"
+	rows, err := db.Query(s, currencyid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rr := []*CurrencyRate{}
+	for rows.Next() {
+		var cr CurrencyRate
+		err := rows.Scan(&cr.Currencyrateid, &cr.Currencyid, &cr.Date, &cr.Rate)
+		if err != nil {
+			return nil, err
+		}
+		rr = append(rr, &cr)
+	}
+	return rr, rows.Err()
+}
+
+// USD rate of a currency in effect on date: the latest rate dated on or
+// before date. Dates before the first recorded rate use the first rate, and
+// a currency without history uses its Usdrate.
+func rateAsOf(db *sql.DB, currencyid int64, date string) (float64, error) {
+	s := `SELECT IFNULL(
+(SELECT rate FROM currencyrate WHERE currency_id = ?1 AND date <= ?2 ORDER BY date DESC LIMIT 1),
+IFNULL((SELECT rate FROM currencyrate WHERE currency_id = ?1 ORDER BY date LIMIT 1),
+(SELECT usdrate FROM currency WHERE currency_id = ?1)))`
+	var rate sql.NullFloat64
+	err := db.QueryRow(s, currencyid, date).Scan(&rate)
+	if err != nil {
+		return 0.0, err
+	}
+	return rate.Float64, nil
+}
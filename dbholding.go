@@ -0,0 +1,140 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Shares of a security held in an account, valued at Price on Pricedate.
+// Pricecur is the currency of Price, and Value is converted from it to the
+// account's currency if they differ. Cost is the cost basis of the shares
+// under the account's cost method and Gain the unrealized gain, Value - Cost.
+type Holding struct {
+	Accountid int64     `json:"accountid"`
+	Symbol    string    `json:"symbol"`
+	Qty       Fixed     `json:"qty"`
+	Price     Fixed     `json:"price"`
+	Pricedate string    `json:"pricedate"`
+	Pricecur  *Currency `json:"pricecur"`
+	Value     Money     `json:"value"`
+	Cost      Money     `json:"cost"`
+	Gain      Money     `json:"gain"`
+}
+
+// Securities with shares remaining in an account, ordered by symbol.
+// Each holding is valued at its latest price from the price table, or at
+// the price of its most recent transaction if that is more recent or there
+// is no price.
+func findHoldings(db *sql.DB, accountid int64) ([]*Holding, error) {
+	return findHoldingsAsOf(db, accountid, "")
+}
+
+// Holdings at the end of day asof, valued at the latest price on or before
+// asof. Blank asof is the same as findHoldings().
+func findHoldingsAsOf(db *sql.DB, accountid int64, asof string) ([]*Holding, error) {
+	cur, err := findAccountCurrency(db, accountid)
+	if err != nil {
+		return nil, err
+	}
+	cv, err := newConverter(db)
+	if err != nil {
+		return nil, err
+	}
+
+	s := `SELECT symbol, SUM(qty),
+IFNULL((SELECT t2.price FROM trans t2 WHERE t2.account_id = t.account_id AND t2.symbol = t.symbol AND t2.price <> 0 AND (?2 = '' OR t2.date <= ?2) ORDER BY t2.date DESC, t2.trans_id DESC LIMIT 1), 0),
+IFNULL((SELECT t2.date FROM trans t2 WHERE t2.account_id = t.account_id AND t2.symbol = t.symbol AND t2.price <> 0 AND (?2 = '' OR t2.date <= ?2) ORDER BY t2.date DESC, t2.trans_id DESC LIMIT 1), '')
+FROM trans t WHERE account_id = ?1 AND symbol <> '' AND (?2 = '' OR date <= ?2) GROUP BY symbol HAVING SUM(qty) <> 0 ORDER BY symbol`
+	rows, err := db.Query(s, accountid, asof)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hh := []*Holding{}
+	for rows.Next() {
+		h := Holding{Accountid: accountid}
+		err := rows.Scan(&h.Symbol, &h.Qty, &h.Price, &h.Pricedate)
+		if err != nil {
+			return nil, err
+		}
+		h.Pricecur = cur
+		h.Cost = Money{0, cur}
+		hh = append(hh, &h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, h := range hh {
+		p, err := latestPrice(db, h.Symbol, asof)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil && p.Date >= h.Pricedate {
+			pcur, ok := cv.curs[p.Currencyid]
+			if !ok {
+				return nil, fmt.Errorf("price %d has unknown currency %d", p.Priceid, p.Currencyid)
+			}
+			h.Price = p.Price
+			h.Pricedate = p.Date
+			h.Pricecur = pcur
+		}
+		h.Value, err = cv.ConvertAsOf(stockAmt(h.Qty, h.Price, h.Pricecur), cur, h.Pricedate)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Cost basis from open lots. If lots can't be matched (ex. more shares
+	// sold than bought), cost is left at zero.
+	lots, err := findLots(db, accountid, asof)
+	if err != nil {
+		lots = nil
+	}
+	for _, h := range hh {
+		for _, lot := range lots {
+			if lot.Symbol == h.Symbol {
+				h.Cost = h.Cost.Add(lot.Cost)
+			}
+		}
+		h.Gain = h.Value.Sub(h.Cost)
+	}
+	return hh, nil
+}
+
+// Total market value of an account's holdings at the end of day asof
+// (blank for now).
+func holdingsValue(db *sql.DB, accountid int64, asof string) (Money, error) {
+	cur, err := findAccountCurrency(db, accountid)
+	if err != nil {
+		return Money{}, err
+	}
+	hh, err := findHoldingsAsOf(db, accountid, asof)
+	if err != nil {
+		return Money{}, err
+	}
+	tot := Money{0, cur}
+	for _, h := range hh {
+		tot = tot.Add(h.Value)
+	}
+	return tot, nil
+}
+
+// Value of an account for net worth at the end of day asof (blank for now):
+// market value of holdings for accounts whose type tracks shares, the
+// balance for other accounts.
+func valAccount(db *sql.DB, accountid int64, asof string) Money {
+	var isshares bool
+	s := "SELECT t.isshares FROM account a INNER JOIN accounttype t ON t.accounttype_id = a.accounttype_id WHERE a.account_id = ?"
+	err := db.QueryRow(s, accountid).Scan(&isshares)
+	if err != nil || !isshares {
+		return balAccountAsOf(db, accountid, "", asof)
+	}
+	val, err := holdingsValue(db, accountid, asof)
+	if err != nil {
+		return balAccountAsOf(db, accountid, "", asof)
+	}
+	return val
+}
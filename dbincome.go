@@ -0,0 +1,300 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type PeriodUnit int
+
+const (
+	PeriodMonth PeriodUnit = iota
+	PeriodQuarter
+	PeriodYear
+)
+
+func parsePeriodUnit(s string) (PeriodUnit, error) {
+	switch s {
+	case "", "month":
+		return PeriodMonth, nil
+	case "quarter":
+		return PeriodQuarter, nil
+	case "year":
+		return PeriodYear, nil
+	}
+	return PeriodMonth, fmt.Errorf("Invalid period '%s', use month, quarter or year", s)
+}
+
+func (u PeriodUnit) months() int {
+	switch u {
+	case PeriodQuarter:
+		return 3
+	case PeriodYear:
+		return 12
+	}
+	return 1
+}
+
+// Start of the month, quarter or year that t is in.
+func (u PeriodUnit) start(t time.Time) time.Time {
+	m := t.Month()
+	switch u {
+	case PeriodQuarter:
+		m = (m-1)/3*3 + 1
+	case PeriodYear:
+		m = time.January
+	}
+	return time.Date(t.Year(), m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Label of the period starting at t, ex. "2024-01", "2024 Q1", "2024".
+func (u PeriodUnit) label(t time.Time) string {
+	switch u {
+	case PeriodQuarter:
+		return fmt.Sprintf("%d Q%d", t.Year(), (int(t.Month())+2)/3)
+	case PeriodYear:
+		return t.Format("2006")
+	}
+	return t.Format(monthFormat)
+}
+
+type Period struct {
+	Label   string `json:"label"`
+	Startdt string `json:"startdt"`
+	Enddt   string `json:"enddt"`
+}
+
+// Split startdt to enddt into months, quarters or years. The first and last
+// periods are cut short if the range doesn't start or end on a boundary.
+func splitPeriods(startdt, enddt string, unit PeriodUnit) []*Period {
+	start, err := time.Parse(dateFormat, startdt)
+	if err != nil {
+		return nil
+	}
+	end, err := time.Parse(dateFormat, enddt)
+	if err != nil {
+		return nil
+	}
+	pp := []*Period{}
+	for t := unit.start(start); !t.After(end); t = t.AddDate(0, unit.months(), 0) {
+		p := Period{
+			Label:   unit.label(t),
+			Startdt: t.Format(dateFormat),
+			Enddt:   t.AddDate(0, unit.months(), -1).Format(dateFormat),
+		}
+		if p.Startdt < startdt {
+			p.Startdt = startdt
+		}
+		if p.Enddt > enddt {
+			p.Enddt = enddt
+		}
+		pp = append(pp, &p)
+	}
+	return pp
+}
+
+// Line of the income and expense report with one amount per period.
+// Id is the category or account id, 0 for subtotals.
+type IncomeRow struct {
+	Id    int64   `json:"id"`
+	Label string  `json:"label"`
+	Depth int     `json:"depth"` // subcategory level
+	Amts  []Money `json:"amts"`
+	Total Money   `json:"total"`
+}
+
+type IncomeSection struct {
+	Name     string       `json:"name"`
+	Rows     []*IncomeRow `json:"rows"`
+	Subtotal *IncomeRow   `json:"subtotal"`
+}
+
+// Income and expenses per period in currency Repcur. Income amounts are
+// positive and expenses negative so that Net is Income plus Expenses.
+type IncomeReport struct {
+	Repcur   *Currency      `json:"repcur"`
+	Periods  []*Period      `json:"periods"`
+	Income   *IncomeSection `json:"income"`
+	Expenses *IncomeSection `json:"expenses"`
+	Net      *IncomeRow     `json:"net"`
+}
+
+func newIncomeRow(id int64, label string, depth int, n int, repcur *Currency) *IncomeRow {
+	r := IncomeRow{
+		Id:    id,
+		Label: label,
+		Depth: depth,
+		Amts:  make([]Money, n),
+		Total: Money{0, repcur},
+	}
+	for i := range r.Amts {
+		r.Amts[i] = Money{0, repcur}
+	}
+	return &r
+}
+
+func (r *IncomeRow) add(i int, m Money) {
+	r.Amts[i] = r.Amts[i].Add(m)
+	r.Total = r.Total.Add(m)
+}
+
+func (r *IncomeRow) addRow(r2 *IncomeRow) {
+	for i, m := range r2.Amts {
+		r.add(i, m)
+	}
+}
+
+// Income and expenses from startdt to enddt per month, quarter or year,
+// converted to repcur at the rate on each transaction's date.
+//
+// By category, each top level category and its subcategories fall under
+// income or expenses by the sign of its total for the whole range.
+// Transactions without a category aren't counted.
+//
+// By account, the rows are the accounts of nominal types (income, expense
+// and equity) other than the exchange and uncategorized system accounts,
+// with their postings negated so that income is positive. Each account falls
+// under income or expenses by the sign of its total for the whole range.
+func findIncomeReport(db *sql.DB, repcur *Currency, startdt, enddt string, unit PeriodUnit, byaccount bool) (*IncomeReport, error) {
+	if !isDate(startdt) {
+		return nil, fmt.Errorf("Invalid start date '%s', use YYYY-MM-DD", startdt)
+	}
+	if !isDate(enddt) {
+		return nil, fmt.Errorf("Invalid end date '%s', use YYYY-MM-DD", enddt)
+	}
+	cv, err := newConverter(db)
+	if err != nil {
+		return nil, err
+	}
+
+	rpt := IncomeReport{
+		Repcur:   repcur,
+		Periods:  splitPeriods(startdt, enddt, unit),
+		Income:   &IncomeSection{Name: "Income"},
+		Expenses: &IncomeSection{Name: "Expenses"},
+	}
+	n := len(rpt.Periods)
+	rpt.Income.Subtotal = newIncomeRow(0, "Total Income", 0, n, repcur)
+	rpt.Expenses.Subtotal = newIncomeRow(0, "Total Expenses", 0, n, repcur)
+	rpt.Net = newIncomeRow(0, "Net", 0, n, repcur)
+
+	if byaccount {
+		err = incomeByAccount(db, cv, &rpt)
+	} else {
+		err = incomeByCategory(db, cv, &rpt)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rpt.Net.addRow(rpt.Income.Subtotal)
+	rpt.Net.addRow(rpt.Expenses.Subtotal)
+	return &rpt, nil
+}
+
+func incomeByCategory(db *sql.DB, cv *Converter, rpt *IncomeReport) error {
+	cc, err := findCategories(db)
+	if err != nil {
+		return err
+	}
+	n := len(rpt.Periods)
+	rows := map[int64]*IncomeRow{}
+	for i, p := range rpt.Periods {
+		tots, err := categorySums(db, cc, cv, rpt.Repcur, p.Startdt, p.Enddt)
+		if err != nil {
+			return err
+		}
+		for _, c := range cc {
+			tot, ok := tots[c.Categoryid]
+			if !ok {
+				continue
+			}
+			r := rows[c.Categoryid]
+			if r == nil {
+				r = newIncomeRow(c.Categoryid, c.Name, c.Depth(), n, rpt.Repcur)
+				rows[c.Categoryid] = r
+			}
+			r.add(i, tot)
+		}
+	}
+
+	// Categories are in path order so subcategories follow their top level
+	// category into its section.
+	var sect *IncomeSection
+	for _, c := range cc {
+		r := rows[c.Categoryid]
+		if r == nil {
+			continue
+		}
+		if c.Parentid == 0 {
+			sect = rpt.Expenses
+			if r.Total.Units > 0 {
+				sect = rpt.Income
+			}
+			sect.Subtotal.addRow(r)
+		}
+		sect.Rows = append(sect.Rows, r)
+	}
+	return nil
+}
+
+func incomeByAccount(db *sql.DB, cv *Converter, rpt *IncomeReport) error {
+	n := len(rpt.Periods)
+	rows := map[int64]*IncomeRow{}
+	s := `SELECT a.account_id, a.name, a.currency_id, t.date, SUM(t.amt) FROM trans t
+INNER JOIN account a ON a.account_id = t.account_id
+INNER JOIN accounttype at ON at.accounttype_id = a.accounttype_id
+WHERE at.isnominal AND a.code NOT LIKE 'EXCH-%' AND a.code NOT LIKE 'UNCAT-%' AND t.date >= ? AND t.date <= ?
+GROUP BY a.account_id, t.date`
+	for i, p := range rpt.Periods {
+		err := func() error {
+			rs, err := db.Query(s, p.Startdt, p.Enddt)
+			if err != nil {
+				return err
+			}
+			defer rs.Close()
+			for rs.Next() {
+				var accountid, currencyid, sum int64
+				var name, date string
+				err := rs.Scan(&accountid, &name, &currencyid, &date, &sum)
+				if err != nil {
+					return err
+				}
+				m, err := cv.ConvertAsOf(Money{-sum, cv.curs[currencyid]}, rpt.Repcur, date)
+				if err != nil {
+					return err
+				}
+				r := rows[accountid]
+				if r == nil {
+					r = newIncomeRow(accountid, name, 0, n, rpt.Repcur)
+					rows[accountid] = r
+				}
+				r.add(i, m)
+			}
+			return rs.Err()
+		}()
+		if err != nil {
+			return err
+		}
+	}
+
+	rr := []*IncomeRow{}
+	for _, r := range rows {
+		rr = append(rr, r)
+	}
+	sort.Slice(rr, func(i, j int) bool {
+		return rr[i].Label < rr[j].Label
+	})
+	for _, r := range rr {
+		sect := rpt.Expenses
+		if r.Total.Units > 0 {
+			sect = rpt.Income
+		}
+		sect.Rows = append(sect.Rows, r)
+		sect.Subtotal.addRow(r)
+	}
+	return nil
+}
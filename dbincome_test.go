@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestIncomeByAccount(t *testing.T) {
+	db := openTestDB(t)
+	usd, err := findCurrencyByName(db, "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nominal types whose names aren't Income or Expense, and one that
+	// isn't nominal.
+	revenue, err := createAccountType(db, &AccountType{Name: "Revenue", Isnominal: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	costs, err := createAccountType(db, &AccountType{Name: "Costs", Isnominal: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	asset, err := createAccountType(db, &AccountType{Name: "Asset"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := []struct {
+		code   string
+		typeid int64
+		amt    int64
+	}{
+		{"salary", revenue, -300000}, // credit, income
+		{"rent", costs, 120000},
+		{"food", costs, 45000},
+		{"house", asset, 500000},
+		{"EXCH-USD", costs, 999},
+		{"UNCAT-USD", costs, 777},
+	}
+	for _, a := range accounts {
+		id, err := createAccount(db, &Account{Code: a.code, Name: a.code, Accounttypeid: a.typeid, Currencyid: usd.Currencyid})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = createTrans(db, &Trans{Accountid: id, Date: "2024-02-10", Amt: a.amt})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rpt, err := findIncomeReport(db, usd, "2024-01-01", "2024-03-31", PeriodMonth, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		sect *IncomeSection
+		want map[string]int64
+	}{
+		{rpt.Income, map[string]int64{"salary": 300000}},
+		{rpt.Expenses, map[string]int64{"food": -45000, "rent": -120000}},
+	}
+	for _, tt := range tests {
+		got := map[string]int64{}
+		for _, r := range tt.sect.Rows {
+			got[r.Label] = r.Total.Units
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got rows %v, want %v", tt.sect.Name, got, tt.want)
+			continue
+		}
+		for label, amt := range tt.want {
+			if got[label] != amt {
+				t.Errorf("%s: %s = %d, want %d", tt.sect.Name, label, got[label], amt)
+			}
+		}
+	}
+	if rpt.Net.Total.Units != 135000 {
+		t.Errorf("net = %d, want 135000", rpt.Net.Total.Units)
+	}
+}
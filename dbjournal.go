@@ -0,0 +1,426 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//CREATE TABLE journal (journal_id INTEGER PRIMARY KEY NOT NULL)
+
+// Double-entry transaction: postings to two or more accounts whose amounts
+// sum to zero in each currency. Each posting is a trans row in its account,
+// so balances and registers work as before. Postings share the entry's date
+// and ref. A posting with a blank desc takes the entry's desc.
+//
+// Accounts in different currencies can't balance each other directly. An
+// entry across currencies must include postings to each currency's exchange
+// account (see txexchangeAccount) that balance it, as transfers do;
+// otherwise it's rejected with *UnbalancedError.
+type Journal struct {
+	Journalid int64    `json:"journalid"`
+	Date      string   `json:"date"`
+	Ref       string   `json:"ref"`
+	Desc      string   `json:"desc"`
+	Postings  []*Trans `json:"postings"`
+}
+
+// Error returned for a journal entry whose postings don't sum to zero.
+type UnbalancedError struct {
+	Sums []Money // non-zero sum of the postings in each currency
+}
+
+func (e *UnbalancedError) Error() string {
+	var ss []string
+	for _, m := range e.Sums {
+		ss = append(ss, fmt.Sprintf("%s %s", m.CurName(), m))
+	}
+	return fmt.Sprintf("Unbalanced transaction, postings sum to %s instead of zero", strings.Join(ss, ", "))
+}
+
+func txnewJournal(tx *sql.Tx) (int64, error) {
+	result, err := txexec(tx, "INSERT INTO journal DEFAULT VALUES")
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// Check that a journal entry has at least two postings and that they sum
+// to zero in each currency. Returns *UnbalancedError if they don't.
+func txcheckJournal(tx *sql.Tx, journalid int64) error {
+	var n int
+	err := tx.QueryRow("SELECT COUNT(*) FROM trans WHERE journal_id = ?", journalid).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n < 2 {
+		return fmt.Errorf("Transaction needs at least two postings")
+	}
+
+	s := `SELECT c.currency_id, c.name, c.decimals, SUM(t.amt) FROM trans t
+INNER JOIN account a ON a.account_id = t.account_id INNER JOIN currency c ON c.currency_id = a.currency_id
+WHERE t.journal_id = ? GROUP BY c.currency_id HAVING SUM(t.amt) <> 0 ORDER BY c.name`
+	rows, err := tx.Query(s, journalid)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var ue UnbalancedError
+	for rows.Next() {
+		var c Currency
+		var sum int64
+		err := rows.Scan(&c.Currencyid, &c.Name, &c.Decimals, &sum)
+		if err != nil {
+			return err
+		}
+		ue.Sums = append(ue.Sums, Money{sum, &c})
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(ue.Sums) > 0 {
+		return &ue
+	}
+	return nil
+}
+
+func createJournal(db *sql.DB, j *Journal) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	id, err := txcreateJournal(tx, j)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+func txcreateJournal(tx *sql.Tx, j *Journal) (int64, error) {
+	var err error
+	j.Journalid, err = txnewJournal(tx)
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range j.Postings {
+		p.Transid, err = txcreateTrans(tx, j.posting(p))
+		if err != nil {
+			return 0, err
+		}
+	}
+	err = txcheckJournal(tx, j.Journalid)
+	if err != nil {
+		return 0, err
+	}
+	return j.Journalid, nil
+}
+
+// Posting p with the entry's journal id, date, ref and default desc.
+func (j *Journal) posting(p *Trans) *Trans {
+	p.Journalid = j.Journalid
+	p.Date = j.Date
+	p.Ref = j.Ref
+	if p.Desc == "" {
+		p.Desc = j.Desc
+	}
+	return p
+}
+
+// Update a journal entry. Postings with a Transid are updated, those
+// without are added and postings no longer in j.Postings are deleted.
+// Transfers are edited with editTransfer() instead.
+func editJournal(db *sql.DB, j *Journal) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = txeditJournal(tx, j)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+func txeditJournal(tx *sql.Tx, j *Journal) error {
+	var n int
+	s := "SELECT COUNT(*) FROM transfer x INNER JOIN trans t ON t.trans_id = x.from_trans_id WHERE t.journal_id = ?"
+	err := tx.QueryRow(s, j.Journalid).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("Transaction is a transfer, edit it as a transfer")
+	}
+
+	// Postings to update must already belong to this entry, or the entry
+	// they were taken from would be left unbalanced.
+	keep := []interface{}{j.Journalid}
+	for _, p := range j.Postings {
+		if p.Transid == 0 {
+			continue
+		}
+		s := "SELECT COUNT(*) FROM trans WHERE trans_id = ? AND journal_id = ?"
+		err := tx.QueryRow(s, p.Transid, j.Journalid).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("Posting %d isn't part of transaction %d", p.Transid, j.Journalid)
+		}
+		keep = append(keep, p.Transid)
+	}
+	cond := "journal_id = ?"
+	if len(keep) > 1 {
+		cond += " AND trans_id NOT IN (?" + strings.Repeat(", ?", len(keep)-2) + ")"
+	}
+	err = txcheckUnlocked(tx, cond, keep...)
+	if err != nil {
+		return err
+	}
+	_, err = txexec(tx, "DELETE FROM trans WHERE "+cond, keep...)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range j.Postings {
+		if p.Transid == 0 {
+			p.Transid, err = txcreateTrans(tx, j.posting(p))
+		} else {
+			err = txeditTrans(tx, j.posting(p))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return txcheckJournal(tx, j.Journalid)
+}
+
+// Delete journal entry and all its postings.
+func delJournal(db *sql.DB, journalid int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = txdelJournal(tx, journalid)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+func txdelJournal(tx *sql.Tx, journalid int64) error {
+	err := txcheckUnlocked(tx, "journal_id = ?", journalid)
+	if err != nil {
+		return err
+	}
+	s := "DELETE FROM transfer WHERE from_trans_id IN (SELECT trans_id FROM trans WHERE journal_id = ?1) OR to_trans_id IN (SELECT trans_id FROM trans WHERE journal_id = ?1)"
+	_, err = txexec(tx, s, journalid)
+	if err != nil {
+		return err
+	}
+	_, err = txexec(tx, "DELETE FROM trans WHERE journal_id = ?", journalid)
+	if err != nil {
+		return err
+	}
+	_, err = txexec(tx, "DELETE FROM journal WHERE journal_id = ?", journalid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// After posting t was edited, give the other postings of its journal entry
+// the same date and ref and check that the entry still balances.
+// Does nothing for single-entry transactions.
+func txsyncJournal(tx *sql.Tx, t *Trans) error {
+	var journalid int64
+	err := tx.QueryRow("SELECT IFNULL(journal_id, 0) FROM trans WHERE trans_id = ?", t.Transid).Scan(&journalid)
+	if err != nil {
+		return err
+	}
+	if journalid == 0 {
+		return nil
+	}
+	err = txcheckUnlocked(tx, "journal_id = ? AND (date <> ? OR ref <> ?)", journalid, t.Date, t.Ref)
+	if err != nil {
+		return err
+	}
+	s := "UPDATE trans SET date = ?, ref = ? WHERE journal_id = ?"
+	_, err = txexec(tx, s, t.Date, t.Ref, journalid)
+	if err != nil {
+		return err
+	}
+	return txcheckJournal(tx, journalid)
+}
+
+func findJournal(db *sql.DB, journalid int64) (*Journal, error) {
+	s := "SELECT " + transCols + " FROM trans WHERE journal_id = ? ORDER BY trans_id"
+	rows, err := db.Query(s, journalid)
+	if err != nil {
+		return nil, err
+	}
+	tt, err := scanTrans(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(tt) == 0 {
+		return nil, nil
+	}
+	j := Journal{
+		Journalid: journalid,
+		Date:      tt[0].Date,
+		Ref:       tt[0].Ref,
+		Desc:      tt[0].Desc,
+		Postings:  tt,
+	}
+	return &j, nil
+}
+
+// Find or create the equity account holding one side of postings in
+// currency cur. Created accounts use code '<prefix>-<currency>', ex.
+// 'EXCH-PHP'.
+func txsystemAccount(tx *sql.Tx, prefix, name string, cur *Currency) (int64, error) {
+	code := prefix + "-" + cur.Name
+	var id int64
+	err := tx.QueryRow("SELECT account_id FROM account WHERE code = ? AND currency_id = ?", code, cur.Currencyid).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	var typeid int64
+	err = tx.QueryRow("SELECT accounttype_id FROM accounttype WHERE name = 'Equity'").Scan(&typeid)
+	if err == sql.ErrNoRows {
+		result, err := txexec(tx, "INSERT INTO accounttype (name, isnominal) VALUES ('Equity', 1)")
+		if err != nil {
+			return 0, err
+		}
+		typeid, err = result.LastInsertId()
+		if err != nil {
+			return 0, err
+		}
+	} else if err != nil {
+		return 0, err
+	}
+
+	s := "INSERT INTO account (code, name, accounttype_id, currency_id) VALUES (?, ?, ?, ?)"
+	result, err := txexec(tx, s, code, fmt.Sprintf("%s %s", name, cur.Name), typeid, cur.Currencyid)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// Account balancing the currency cur side of entries across currencies.
+func txexchangeAccount(tx *sql.Tx, cur *Currency) (int64, error) {
+	return txsystemAccount(tx, "EXCH", "Currency Exchange", cur)
+}
+
+// Account taking the other side of converted single-entry transactions.
+func txuncategorizedAccount(tx *sql.Tx, cur *Currency) (int64, error) {
+	return txsystemAccount(tx, "UNCAT", "Uncategorized", cur)
+}
+
+// Convert single-entry transactions to double-entry journal entries.
+// Both legs of a transfer become one entry. Any other transaction is
+// balanced by a posting to the Uncategorized account of its currency.
+// Transactions already part of an entry are left alone, so it is safe to
+// run again after entering more single-entry transactions.
+// Returns the number of transactions converted.
+func convertSingleEntry(db *sql.DB) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	n, err := txconvertSingleEntry(tx)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+func txconvertSingleEntry(tx *sql.Tx) (int, error) {
+	s := transferSelect + " WHERE f.journal_id IS NULL ORDER BY x.transfer_id"
+	rows, err := tx.Query(s)
+	if err != nil {
+		return 0, err
+	}
+	xx := []*Transfer{}
+	for rows.Next() {
+		var x Transfer
+		err := scanTransferRow(rows, &x)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		xx = append(xx, &x)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, x := range xx {
+		journalid, err := txnewJournal(tx)
+		if err != nil {
+			return 0, err
+		}
+		_, err = txexec(tx, "UPDATE trans SET journal_id = ? WHERE trans_id IN (?, ?)", journalid, x.Fromtransid, x.Totransid)
+		if err != nil {
+			return 0, err
+		}
+		err = txpostExchange(tx, journalid, x)
+		if err != nil {
+			return 0, err
+		}
+		n += 2
+	}
+
+	rows, err = tx.Query("SELECT " + transCols + " FROM trans WHERE journal_id IS NULL ORDER BY trans_id")
+	if err != nil {
+		return 0, err
+	}
+	tt, err := scanTrans(rows)
+	if err != nil {
+		return 0, err
+	}
+	for _, t := range tt {
+		cur, err := txfindAccountCurrency(tx, t.Accountid)
+		if err != nil {
+			return 0, err
+		}
+		uncat, err := txuncategorizedAccount(tx, cur)
+		if err != nil {
+			return 0, err
+		}
+		journalid, err := txnewJournal(tx)
+		if err != nil {
+			return 0, err
+		}
+		_, err = txexec(tx, "UPDATE trans SET journal_id = ? WHERE trans_id = ?", journalid, t.Transid)
+		if err != nil {
+			return 0, err
+		}
+		other := Trans{Accountid: uncat, Date: t.Date, Ref: t.Ref, Desc: t.Desc, Amt: -t.Amt, Journalid: journalid}
+		_, err = txcreateTrans(tx, &other)
+		if err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, nil
+}
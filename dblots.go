@@ -0,0 +1,156 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+)
+
+// Shares of one buy that haven't been sold yet. With CostAverage all buys
+// of a symbol are pooled into a single lot dated at the first buy.
+type Lot struct {
+	Transid int64  `json:"transid"`
+	Symbol  string `json:"symbol"`
+	Date    string `json:"date"`
+	Qty     Fixed  `json:"qty"`  // shares remaining
+	Cost    Money  `json:"cost"` // cost basis of the remaining shares
+}
+
+// Gain on the shares sold by one sell transaction.
+type RealizedGain struct {
+	Transid  int64  `json:"transid"`
+	Symbol   string `json:"symbol"`
+	Date     string `json:"date"`
+	Qty      Fixed  `json:"qty"` // shares sold, positive
+	Proceeds Money  `json:"proceeds"`
+	Cost     Money  `json:"cost"`
+	Gain     Money  `json:"gain"`
+}
+
+// Cash amount of a trade. Trades entered without an amount use qty * price.
+func tradeAmt(t *Trans, cur *Currency) Money {
+	if t.Amt != 0 {
+		return Money{t.Amt, cur}
+	}
+	return stockAmt(t.Qty, t.Price, cur)
+}
+
+// Replay an account's trades in date order up to enddt (blank for all),
+// matching each sell against the open lots using the account's cost method.
+// Returns the lots still open and the gain realized by each sell.
+func computeLots(db *sql.DB, accountid int64, enddt string) ([]*Lot, []*RealizedGain, error) {
+	a, err := findAccount(db, accountid)
+	if err != nil {
+		return nil, nil, err
+	}
+	if a == nil {
+		return nil, nil, fmt.Errorf("account %d doesn't exist", accountid)
+	}
+	cur, err := findAccountCurrency(db, accountid)
+	if err != nil {
+		return nil, nil, err
+	}
+	tt, err := findTransByDate(db, accountid, "", enddt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lotsBySymbol := map[string][]*Lot{}
+	var symbols []string
+	var gains []*RealizedGain
+
+	for _, t := range tt {
+		if t.Symbol == "" || t.Qty == 0 {
+			continue
+		}
+		lots, ok := lotsBySymbol[t.Symbol]
+		if !ok {
+			symbols = append(symbols, t.Symbol)
+		}
+
+		if t.Qty > 0 {
+			cost := tradeAmt(t, cur)
+			if a.Costmethod == CostAverage && len(lots) > 0 {
+				lots[0].Qty += t.Qty
+				lots[0].Cost = lots[0].Cost.Add(cost)
+			} else {
+				lots = append(lots, &Lot{t.Transid, t.Symbol, t.Date, t.Qty, cost})
+			}
+			lotsBySymbol[t.Symbol] = lots
+			continue
+		}
+
+		g := RealizedGain{
+			Transid:  t.Transid,
+			Symbol:   t.Symbol,
+			Date:     t.Date,
+			Qty:      -t.Qty,
+			Proceeds: tradeAmt(t, cur).Neg(),
+			Cost:     Money{0, cur},
+		}
+		remaining := g.Qty
+		for remaining > 0 {
+			if len(lots) == 0 {
+				return nil, nil, fmt.Errorf("%s: sell of %s %s exceeds shares held by %s", t.Date, g.Qty, t.Symbol, remaining)
+			}
+			i := 0
+			if a.Costmethod == CostLIFO {
+				i = len(lots) - 1
+			}
+			lot := lots[i]
+
+			take := remaining
+			if take > lot.Qty {
+				take = lot.Qty
+			}
+			cost := lot.Cost
+			if take < lot.Qty {
+				cost = lot.Cost.Mul(new(big.Rat).SetFrac64(int64(take), int64(lot.Qty)), RoundHalfEven)
+			}
+			g.Cost = g.Cost.Add(cost)
+			lot.Cost = lot.Cost.Sub(cost)
+			lot.Qty -= take
+			remaining -= take
+
+			if lot.Qty == 0 {
+				lots = append(lots[:i], lots[i+1:]...)
+			}
+		}
+		lotsBySymbol[t.Symbol] = lots
+		g.Gain = g.Proceeds.Sub(g.Cost)
+		gains = append(gains, &g)
+	}
+
+	lots := []*Lot{}
+	for _, sym := range symbols {
+		lots = append(lots, lotsBySymbol[sym]...)
+	}
+	return lots, gains, nil
+}
+
+// Open lots of an account at the end of day asof (blank for now), in order
+// of symbol first seen then date bought.
+func findLots(db *sql.DB, accountid int64, asof string) ([]*Lot, error) {
+	lots, _, err := computeLots(db, accountid, asof)
+	return lots, err
+}
+
+// Gains realized by sells dated from startdt to enddt inclusive.
+// An empty startdt or enddt leaves that end of the range open.
+func findRealizedGains(db *sql.DB, accountid int64, startdt, enddt string) ([]*RealizedGain, error) {
+	_, gains, err := computeLots(db, accountid, enddt)
+	if err != nil {
+		return nil, err
+	}
+	gg := []*RealizedGain{}
+	for _, g := range gains {
+		if startdt != "" && g.Date < startdt {
+			continue
+		}
+		if enddt != "" && g.Date > enddt {
+			continue
+		}
+		gg = append(gg, g)
+	}
+	return gg, nil
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+	"strings"
+)
+
+// The schema version of a db file is kept in sqlite's user_version pragma.
+// migrations[i] upgrades a db from version i to version i+1, so the
+// version this program expects is len(migrations).
+//
+// Never edit a migration that has been released. Append a new one instead.
+var migrations = []func(tx *sql.Tx) error{
+	migrate1,
+	migrate2,
+	migrate3,
+	migrate4,
+	migrate5,
+	migrate6,
+	migrate7,
+	migrate8,
+	migrate9,
+	migrate10,
+	migrate11,
+	migrate12,
+	migrate13,
+	migrate14,
+	migrate15,
+	migrate16,
+	migrate17,
+	migrate18,
+}
+
+func schemaVersion(db *sql.DB) (int, error) {
+	var ver int
+	err := db.QueryRow("PRAGMA user_version").Scan(&ver)
+	if err != nil {
+		return 0, err
+	}
+	return ver, nil
+}
+
+// Open db file and bring its schema up to date.
+// Foreign key constraints are enforced on every connection.
+func openDB(dbfile string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", dbfile+"?_foreign_keys=1")
+	if err != nil {
+		return nil, err
+	}
+	err = migrateDB(db, dbfile)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Apply all pending migrations, each one in its own transaction.
+// A db that already has data is backed up to <dbfile>.v<N>.bak first.
+func migrateDB(db *sql.DB, dbfile string) error {
+	ver, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if ver > len(migrations) {
+		return fmt.Errorf("Database '%s' has schema version %d but this program only supports up to version %d. Use a newer version of t to open it.", dbfile, ver, len(migrations))
+	}
+	if ver == len(migrations) {
+		return nil
+	}
+
+	var ntables int
+	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'").Scan(&ntables)
+	if err != nil {
+		return err
+	}
+	if ntables > 0 {
+		bakfile := fmt.Sprintf("%s.v%d.bak", dbfile, ver)
+		if !fileExists(bakfile) {
+			_, err := db.Exec("VACUUM INTO ?", bakfile)
+			if err != nil {
+				return fmt.Errorf("Error backing up '%s' to '%s' (%s)", dbfile, bakfile, err)
+			}
+		}
+	}
+
+	// Migrations may need to rebuild tables, which sqlite only allows with
+	// foreign keys off. Foreign keys are checked before each commit instead.
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF")
+	if err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	for v := ver; v < len(migrations); v++ {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		err = migrations[v](tx)
+		if err == nil {
+			err = fkCheck(tx)
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("Error upgrading '%s' to schema version %d (%s)", dbfile, v+1, err)
+		}
+		_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", v+1))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Return error describing any rows that violate a foreign key constraint.
+func fkCheck(tx *sql.Tx) error {
+	rows, err := tx.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var ss []string
+	for rows.Next() {
+		var table, parent string
+		var rowid sql.NullInt64
+		var fkid int
+		err := rows.Scan(&table, &rowid, &parent, &fkid)
+		if err != nil {
+			return err
+		}
+		ss = append(ss, fmt.Sprintf("%s row %d refers to missing %s", table, rowid.Int64, parent))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(ss) > 0 {
+		return fmt.Errorf("foreign key check failed: %s", strings.Join(ss, "; "))
+	}
+	return nil
+}
+
+func txexecs(tx *sql.Tx, ss []string) error {
+	for _, s := range ss {
+		_, err := txexec(tx, s)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Version 1: the original tables.
+// Files created before schema versioning already have these tables and
+// report version 0, so this must be safe to run on them.
+func migrate1(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"CREATE TABLE IF NOT EXISTS currency (currency_id INTEGER PRIMARY KEY NOT NULL, name TEXT, usdrate REAL);",
+		"CREATE TABLE IF NOT EXISTS account (account_id INTEGER PRIMARY KEY NOT NULL, code TEXT, name TEXT, accounttype INTEGER, currency_id INTEGER);",
+		"CREATE TABLE IF NOT EXISTS trans (trans_id INTEGER PRIMARY KEY NOT NULL, account_id INTEGER, date TEXT, ref TEXT, desc TEXT, amt REAL);",
+	})
+}
+
+// Version 2: account types become rows in the accounttype table.
+// The old account.accounttype enum (0=bank, 1=stock) maps to ids 1 and 2.
+func migrate2(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"CREATE TABLE accounttype (accounttype_id INTEGER PRIMARY KEY NOT NULL, name TEXT, isshares INTEGER NOT NULL DEFAULT 0, ischeck INTEGER NOT NULL DEFAULT 0);",
+		"INSERT INTO accounttype (accounttype_id, name, isshares, ischeck) VALUES (1, 'Bank', 0, 1), (2, 'Stock', 1, 0), (3, 'Credit Card', 0, 0), (4, 'Cash', 0, 0), (5, 'Loan', 0, 0);",
+		"ALTER TABLE account ADD COLUMN accounttype_id INTEGER;",
+		"UPDATE account SET accounttype_id = IFNULL(accounttype, 0) + 1;",
+		"ALTER TABLE account DROP COLUMN accounttype;",
+	})
+}
+
+// Version 3: declare foreign keys between account, currency, accounttype and
+// trans. sqlite can't add constraints to existing tables so both account and
+// trans are rebuilt.
+//
+// Rows already orphaned by earlier deletes are kept, not dropped: accounts
+// with a missing currency or type are given placeholder ones, and
+// transactions with a missing account are moved to an 'orphaned' account.
+func migrate3(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"INSERT INTO currency (name, usdrate) SELECT 'Unknown', 1.0 WHERE EXISTS (SELECT 1 FROM account a WHERE a.currency_id IS NULL OR NOT EXISTS (SELECT 1 FROM currency c WHERE c.currency_id = a.currency_id));",
+		"UPDATE account SET currency_id = (SELECT MAX(currency_id) FROM currency WHERE name = 'Unknown') WHERE currency_id IS NULL OR currency_id NOT IN (SELECT currency_id FROM currency);",
+		"INSERT INTO accounttype (name) SELECT 'Unknown' WHERE EXISTS (SELECT 1 FROM account a WHERE a.accounttype_id IS NULL OR NOT EXISTS (SELECT 1 FROM accounttype t WHERE t.accounttype_id = a.accounttype_id));",
+		"UPDATE account SET accounttype_id = (SELECT MAX(accounttype_id) FROM accounttype WHERE name = 'Unknown') WHERE accounttype_id IS NULL OR accounttype_id NOT IN (SELECT accounttype_id FROM accounttype);",
+		"INSERT INTO account (code, name, accounttype_id, currency_id) SELECT 'orphaned', 'Orphaned Transactions', (SELECT MIN(accounttype_id) FROM accounttype), (SELECT MIN(currency_id) FROM currency) WHERE EXISTS (SELECT 1 FROM trans t WHERE t.account_id IS NULL OR NOT EXISTS (SELECT 1 FROM account a WHERE a.account_id = t.account_id));",
+		"UPDATE trans SET account_id = (SELECT MAX(account_id) FROM account WHERE code = 'orphaned') WHERE account_id IS NULL OR account_id NOT IN (SELECT account_id FROM account);",
+
+		"CREATE TABLE account_new (account_id INTEGER PRIMARY KEY NOT NULL, code TEXT, name TEXT, accounttype_id INTEGER NOT NULL REFERENCES accounttype(accounttype_id), currency_id INTEGER NOT NULL REFERENCES currency(currency_id));",
+		"INSERT INTO account_new (account_id, code, name, accounttype_id, currency_id) SELECT account_id, code, name, accounttype_id, currency_id FROM account;",
+		"DROP TABLE account;",
+		"ALTER TABLE account_new RENAME TO account;",
+		"CREATE INDEX account_currency ON account (currency_id);",
+		"CREATE INDEX account_accounttype ON account (accounttype_id);",
+
+		"CREATE TABLE trans_new (trans_id INTEGER PRIMARY KEY NOT NULL, account_id INTEGER NOT NULL REFERENCES account(account_id), date TEXT, ref TEXT, desc TEXT, amt REAL);",
+		"INSERT INTO trans_new (trans_id, account_id, date, ref, desc, amt) SELECT trans_id, account_id, date, ref, desc, amt FROM trans;",
+		"DROP TABLE trans;",
+		"ALTER TABLE trans_new RENAME TO trans;",
+		"CREATE INDEX trans_account ON trans (account_id, date);",
+	})
+}
+
+// Version 4: accounts can be marked inactive (closed) instead of deleted.
+func migrate4(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"ALTER TABLE account ADD COLUMN inactive INTEGER NOT NULL DEFAULT 0;",
+	})
+}
+
+// Version 5: amounts are stored as integer minor units instead of REAL.
+// All existing currencies get 2 decimals, so REAL amounts are converted to
+// cents, rounding half away from zero. trans is rebuilt so that amt gets
+// INTEGER affinity.
+func migrate5(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"ALTER TABLE currency ADD COLUMN decimals INTEGER NOT NULL DEFAULT 2;",
+
+		"CREATE TABLE trans_new (trans_id INTEGER PRIMARY KEY NOT NULL, account_id INTEGER NOT NULL REFERENCES account(account_id), date TEXT, ref TEXT, desc TEXT, amt INTEGER NOT NULL DEFAULT 0);",
+		"INSERT INTO trans_new (trans_id, account_id, date, ref, desc, amt) SELECT trans_id, account_id, date, ref, desc, CAST(ROUND(IFNULL(amt, 0) * 100) AS INTEGER) FROM trans;",
+		"DROP TABLE trans;",
+		"ALTER TABLE trans_new RENAME TO trans;",
+		"CREATE INDEX trans_account ON trans (account_id, date);",
+	})
+}
+
+// Version 6: currency rate history. Each currency's history starts with its
+// current usdrate as of the upgrade date.
+func migrate6(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"CREATE TABLE currencyrate (currencyrate_id INTEGER PRIMARY KEY NOT NULL, currency_id INTEGER NOT NULL REFERENCES currency(currency_id) ON DELETE CASCADE, date TEXT NOT NULL, rate REAL NOT NULL, UNIQUE (currency_id, date));",
+		"INSERT INTO currencyrate (currency_id, date, rate) SELECT currency_id, date('now', 'localtime'), usdrate FROM currency WHERE usdrate IS NOT NULL;",
+	})
+}
+
+// Version 7: stock transactions record the security, shares and price.
+func migrate7(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"ALTER TABLE trans ADD COLUMN symbol TEXT NOT NULL DEFAULT '';",
+		"ALTER TABLE trans ADD COLUMN qty INTEGER NOT NULL DEFAULT 0;",
+		"ALTER TABLE trans ADD COLUMN price INTEGER NOT NULL DEFAULT 0;",
+		"CREATE INDEX trans_symbol ON trans (account_id, symbol, date);",
+	})
+}
+
+// Version 8: per account cost basis method (0=FIFO, 1=LIFO, 2=average).
+func migrate8(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"ALTER TABLE account ADD COLUMN costmethod INTEGER NOT NULL DEFAULT 0;",
+	})
+}
+
+// Version 9: security prices.
+func migrate9(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"CREATE TABLE price (price_id INTEGER PRIMARY KEY NOT NULL, symbol TEXT NOT NULL, date TEXT NOT NULL, price INTEGER NOT NULL, currency_id INTEGER NOT NULL REFERENCES currency(currency_id) ON DELETE CASCADE, UNIQUE (symbol, date, currency_id));",
+	})
+}
+
+// Version 10: transfers link the withdrawal and deposit legs of a movement
+// of money between two accounts.
+func migrate10(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"CREATE TABLE transfer (transfer_id INTEGER PRIMARY KEY NOT NULL, from_trans_id INTEGER NOT NULL UNIQUE REFERENCES trans(trans_id), to_trans_id INTEGER NOT NULL UNIQUE REFERENCES trans(trans_id), rate REAL NOT NULL DEFAULT 1.0);",
+	})
+}
+
+// Version 11: double-entry. Transactions become postings grouped into
+// journal entries whose amounts sum to zero. Income, expense and equity
+// account types hold the other side of postings to bank and stock accounts.
+func migrate11(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"ALTER TABLE accounttype ADD COLUMN isnominal INTEGER NOT NULL DEFAULT 0;",
+		"UPDATE accounttype SET isnominal = 1 WHERE name IN ('Income', 'Expense', 'Equity');",
+		"INSERT INTO accounttype (name, isnominal) SELECT 'Income', 1 WHERE NOT EXISTS (SELECT 1 FROM accounttype WHERE name = 'Income');",
+		"INSERT INTO accounttype (name, isnominal) SELECT 'Expense', 1 WHERE NOT EXISTS (SELECT 1 FROM accounttype WHERE name = 'Expense');",
+		"INSERT INTO accounttype (name, isnominal) SELECT 'Equity', 1 WHERE NOT EXISTS (SELECT 1 FROM accounttype WHERE name = 'Equity');",
+		"CREATE TABLE journal (journal_id INTEGER PRIMARY KEY NOT NULL);",
+		"ALTER TABLE trans ADD COLUMN journal_id INTEGER REFERENCES journal(journal_id);",
+		"CREATE INDEX trans_journal ON trans (journal_id);",
+	})
+}
+
+// Version 12: transaction categories and payees.
+func migrate12(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"CREATE TABLE category (category_id INTEGER PRIMARY KEY NOT NULL, parent_id INTEGER REFERENCES category(category_id), name TEXT NOT NULL);",
+		"CREATE UNIQUE INDEX category_name ON category (IFNULL(parent_id, 0), name);",
+		"CREATE TABLE payee (payee_id INTEGER PRIMARY KEY NOT NULL, name TEXT NOT NULL UNIQUE COLLATE NOCASE);",
+		"ALTER TABLE trans ADD COLUMN category_id INTEGER REFERENCES category(category_id);",
+		"ALTER TABLE trans ADD COLUMN payee_id INTEGER REFERENCES payee(payee_id);",
+		"CREATE INDEX trans_category ON trans (category_id, date);",
+		"CREATE INDEX trans_payee ON trans (payee_id, date);",
+	})
+}
+
+// Version 13: transaction tags.
+func migrate13(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"CREATE TABLE tag (tag_id INTEGER PRIMARY KEY NOT NULL, name TEXT NOT NULL UNIQUE COLLATE NOCASE);",
+		"CREATE TABLE transtag (trans_id INTEGER NOT NULL REFERENCES trans(trans_id) ON DELETE CASCADE, tag_id INTEGER NOT NULL REFERENCES tag(tag_id) ON DELETE CASCADE, PRIMARY KEY (trans_id, tag_id));",
+		"CREATE INDEX transtag_tag ON transtag (tag_id);",
+	})
+}
+
+// Version 14: transaction status (0=uncleared, 1=cleared, 2=reconciled)
+// and the statements accounts were reconciled against.
+func migrate14(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"ALTER TABLE trans ADD COLUMN status INTEGER NOT NULL DEFAULT 0;",
+		"CREATE TABLE statement (statement_id INTEGER PRIMARY KEY NOT NULL, account_id INTEGER NOT NULL REFERENCES account(account_id) ON DELETE CASCADE, date TEXT NOT NULL, endbal INTEGER NOT NULL);",
+		"CREATE INDEX statement_account ON statement (account_id, date);",
+	})
+}
+
+// Version 15: scheduled recurring transactions.
+func migrate15(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"CREATE TABLE schedule (schedule_id INTEGER PRIMARY KEY NOT NULL, account_id INTEGER NOT NULL REFERENCES account(account_id), ref TEXT NOT NULL DEFAULT '', desc TEXT NOT NULL DEFAULT '', amt INTEGER NOT NULL DEFAULT 0, category_id INTEGER REFERENCES category(category_id), payee_id INTEGER REFERENCES payee(payee_id), every INTEGER NOT NULL DEFAULT 1, unit INTEGER NOT NULL DEFAULT 0, lastbizday INTEGER NOT NULL DEFAULT 0, startdate TEXT NOT NULL, enddate TEXT NOT NULL DEFAULT '', count INTEGER NOT NULL DEFAULT 0, posted INTEGER NOT NULL DEFAULT 0);",
+		"CREATE INDEX schedule_account ON schedule (account_id);",
+	})
+}
+
+// Version 16: monthly budgets by category.
+func migrate16(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"CREATE TABLE budget (budget_id INTEGER PRIMARY KEY NOT NULL, category_id INTEGER NOT NULL REFERENCES category(category_id) ON DELETE CASCADE, month TEXT NOT NULL, amt INTEGER NOT NULL, currency_id INTEGER NOT NULL REFERENCES currency(currency_id), rollover INTEGER NOT NULL DEFAULT 0, UNIQUE (category_id, month));",
+	})
+}
+
+// Version 17: saved CSV import column mappings per account.
+func migrate17(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"CREATE TABLE csvmapping (account_id INTEGER PRIMARY KEY NOT NULL REFERENCES account(account_id) ON DELETE CASCADE, datecol TEXT NOT NULL DEFAULT '', refcol TEXT NOT NULL DEFAULT '', desccol TEXT NOT NULL DEFAULT '', amtcol TEXT NOT NULL DEFAULT '', debitcol TEXT NOT NULL DEFAULT '', creditcol TEXT NOT NULL DEFAULT '', dateformat TEXT NOT NULL DEFAULT '', decimalsep TEXT NOT NULL DEFAULT '', delimiter TEXT NOT NULL DEFAULT '', skip INTEGER NOT NULL DEFAULT 0, header INTEGER NOT NULL DEFAULT 0);",
+	})
+}
+
+// Version 18: ids of transactions imported from OFX files, to skip them
+// when imported again.
+func migrate18(tx *sql.Tx) error {
+	return txexecs(tx, []string{
+		"CREATE TABLE fitid (account_id INTEGER NOT NULL REFERENCES account(account_id) ON DELETE CASCADE, fitid TEXT NOT NULL, trans_id INTEGER REFERENCES trans(trans_id) ON DELETE SET NULL, PRIMARY KEY (account_id, fitid));",
+	})
+}
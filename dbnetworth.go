@@ -0,0 +1,88 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Net worth at the end of a period and its change over the period.
+// Complete is false if some balances couldn't be converted and were left
+// out.
+type NetWorth struct {
+	Period   *Period `json:"period"`
+	Amt      Money   `json:"amt"`
+	Change   Money   `json:"change"`
+	Complete bool    `json:"complete"`
+}
+
+// Ids of the accounts that count towards net worth, all but the income,
+// expense and equity accounts. Inactive accounts are included since they
+// may have had a balance in the past.
+func findNetWorthAccounts(db *sql.DB) ([]int64, error) {
+	s := "SELECT a.account_id FROM account a INNER JOIN accounttype t ON t.accounttype_id = a.accounttype_id WHERE t.isnominal = 0"
+	rows, err := db.Query(s)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Net worth at the end of day asof in currency repcur, converted at the
+// rates as of asof. Returns false if some balances couldn't be converted.
+func netWorthAsOf(db *sql.DB, cv *Converter, accountids []int64, repcur *Currency, asof string) (Money, bool) {
+	networth := Money{0, repcur}
+	complete := true
+	for _, id := range accountids {
+		bal := valAccount(db, id, asof)
+		cbal, err := cv.ConvertAsOf(bal, repcur, asof)
+		if err != nil {
+			complete = false
+			continue
+		}
+		networth = networth.Add(cbal)
+	}
+	return networth, complete
+}
+
+// Net worth at the end of each month from startdt to enddt in currency
+// repcur. The change of the first month is from the day before startdt.
+func findNetWorth(db *sql.DB, repcur *Currency, startdt, enddt string) ([]*NetWorth, error) {
+	start, err := time.Parse(dateFormat, startdt)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := findNetWorthAccounts(db)
+	if err != nil {
+		return nil, err
+	}
+	cv, err := newConverter(db)
+	if err != nil {
+		return nil, err
+	}
+
+	prev, _ := netWorthAsOf(db, cv, ids, repcur, start.AddDate(0, 0, -1).Format(dateFormat))
+	nn := []*NetWorth{}
+	for _, p := range splitPeriods(startdt, enddt, PeriodMonth) {
+		amt, complete := netWorthAsOf(db, cv, ids, repcur, p.Enddt)
+		nn = append(nn, &NetWorth{
+			Period:   p,
+			Amt:      amt,
+			Change:   amt.Sub(prev),
+			Complete: complete,
+		})
+		prev = amt
+	}
+	return nn, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//CREATE TABLE payee (payee_id INTEGER PRIMARY KEY NOT NULL, name TEXT NOT NULL UNIQUE COLLATE NOCASE)
+
+type Payee struct {
+	Payeeid int64  `json:"payeeid"`
+	Name    string `json:"name"`
+}
+
+// Selects payees for findPayees(). Zero valued fields are ignored.
+type PayeeFilter struct {
+	Name   string // substring of name
+	Limit  int
+	Offset int
+}
+
+func createPayee(db *sql.DB, p *Payee) (int64, error) {
+	s := "INSERT INTO payee (name) VALUES (?)"
+	result, err := sqlexec(db, s, p.Name)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Find payee by name, creating it if there's none.
+func createPayeeName(db *sql.DB, name string) (int64, error) {
+	p, err := findPayeeByName(db, name)
+	if err != nil {
+		return 0, err
+	}
+	if p != nil {
+		return p.Payeeid, nil
+	}
+	return createPayee(db, &Payee{Name: name})
+}
+func txcreatePayeeName(tx *sql.Tx, name string) (int64, error) {
+	var id int64
+	err := tx.QueryRow("SELECT payee_id FROM payee WHERE name = ?", name).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+	result, err := txexec(tx, "INSERT INTO payee (name) VALUES (?)", name)
+	if err != nil {
+		return 0, err
+	}
+	id, err = result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+func editPayee(db *sql.DB, p *Payee) error {
+	s := "UPDATE payee SET name = ? WHERE payee_id = ?"
+	_, err := sqlexec(db, s, p.Name, p.Payeeid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Delete payee. Returns *DependentsError if it has transactions or
+// schedules.
+func delPayee(db *sql.DB, payeeid int64) error {
+	p, err := findPayee(db, payeeid)
+	if err != nil {
+		return err
+	}
+	if p == nil {
+		return nil
+	}
+	var ntrans, nschedules int
+	s := "SELECT (SELECT COUNT(*) FROM trans WHERE payee_id = ?1), (SELECT COUNT(*) FROM schedule WHERE payee_id = ?1)"
+	err = db.QueryRow(s, payeeid).Scan(&ntrans, &nschedules)
+	if err != nil {
+		return err
+	}
+	var deps []string
+	if ntrans > 0 {
+		deps = append(deps, fmt.Sprintf("%d transaction(s)", ntrans))
+	}
+	if nschedules > 0 {
+		deps = append(deps, fmt.Sprintf("%d schedule(s)", nschedules))
+	}
+	if len(deps) > 0 {
+		return &DependentsError{
+			What: fmt.Sprintf("Payee '%s'", p.Name),
+			Deps: deps,
+		}
+	}
+
+	s = "DELETE FROM payee WHERE payee_id = ?"
+	_, err = sqlexec(db, s, payeeid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func findPayee(db *sql.DB, payeeid int64) (*Payee, error) {
+	s := "SELECT payee_id, name FROM payee WHERE payee_id = ?"
+	row := db.QueryRow(s, payeeid)
+	var p Payee
+	err := row.Scan(&p.Payeeid, &p.Name)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Find payee by name, ignoring case.
+func findPayeeByName(db *sql.DB, name string) (*Payee, error) {
+	s := "SELECT payee_id, name FROM payee WHERE name = ?"
+	row := db.QueryRow(s, name)
+	var p Payee
+	err := row.Scan(&p.Payeeid, &p.Name)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Payees ordered by name. nil filter returns all payees.
+func findPayees(db *sql.DB, f *PayeeFilter) ([]*Payee, error) {
+	if f == nil {
+		f = &PayeeFilter{}
+	}
+	var w sqlWhere
+	if f.Name != "" {
+		w.addLike("name", f.Name)
+	}
+	slimit, limitpp := sqlLimit(f.Limit, f.Offset)
+
+	s := "SELECT payee_id, name FROM payee" + w.String() + " ORDER BY name, payee_id" + slimit
+	rows, err := db.Query(s, append(w.pp, limitpp...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pp := []*Payee{}
+	for rows.Next() {
+		var p Payee
+		err := rows.Scan(&p.Payeeid, &p.Name)
+		if err != nil {
+			return nil, err
+		}
+		pp = append(pp, &p)
+	}
+	return pp, rows.Err()
+}
+
+// Total of a payee's transactions.
+type PayeeTotal struct {
+	Payee *Payee `json:"payee"`
+	Amt   Money  `json:"amt"`
+}
+
+// Totals of transactions dated from startdt to enddt (blank for open
+// ended) by payee, in currency repcur at the rate on each transaction's
+// date, ordered by payee name. Transactions without a payee aren't counted.
+func findPayeeTotals(db *sql.DB, repcur *Currency, startdt, enddt string) ([]*PayeeTotal, error) {
+	cv, err := newConverter(db)
+	if err != nil {
+		return nil, err
+	}
+	s := `SELECT p.payee_id, p.name, a.currency_id, t.date, SUM(t.amt) FROM trans t
+INNER JOIN payee p ON p.payee_id = t.payee_id INNER JOIN account a ON a.account_id = t.account_id
+WHERE (?1 = '' OR t.date >= ?1) AND (?2 = '' OR t.date <= ?2)
+GROUP BY p.payee_id, a.currency_id, t.date ORDER BY p.name, p.payee_id`
+	rows, err := db.Query(s, startdt, enddt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ptt := []*PayeeTotal{}
+	for rows.Next() {
+		var p Payee
+		var currencyid, sum int64
+		var date string
+		err := rows.Scan(&p.Payeeid, &p.Name, &currencyid, &date, &sum)
+		if err != nil {
+			return nil, err
+		}
+		m, err := cv.ConvertAsOf(Money{sum, cv.curs[currencyid]}, repcur, date)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(ptt); n > 0 && ptt[n-1].Payee.Payeeid == p.Payeeid {
+			ptt[n-1].Amt = ptt[n-1].Amt.Add(m)
+			continue
+		}
+		ptt = append(ptt, &PayeeTotal{&p, m})
+	}
+	return ptt, rows.Err()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//CREATE TABLE price (price_id INTEGER PRIMARY KEY NOT NULL, symbol TEXT NOT NULL, date TEXT NOT NULL, price INTEGER NOT NULL, currency_id INTEGER NOT NULL REFERENCES currency(currency_id) ON DELETE CASCADE, UNIQUE (symbol, date, currency_id))
+
+// Closing price of a security on a date.
+type Price struct {
+	Priceid    int64  `json:"priceid"`
+	Symbol     string `json:"symbol"`
+	Date       string `json:"date"`
+	Price      Fixed  `json:"price"` // per share
+	Currencyid int64  `json:"currencyid"`
+}
+
+// Add price, replacing any price of the same symbol, date and currency.
+func createPrice(db *sql.DB, p *Price) (int64, error) {
+	s := "INSERT INTO price (symbol, date, price, currency_id) VALUES (?, ?, ?, ?) ON CONFLICT (symbol, date, currency_id) DO UPDATE SET price = excluded.price"
+	_, err := sqlexec(db, s, p.Symbol, p.Date, p.Price, p.Currencyid)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	s = "SELECT price_id FROM price WHERE symbol = ? AND date = ? AND currency_id = ?"
+	err = db.QueryRow(s, p.Symbol, p.Date, p.Currencyid).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+func editPrice(db *sql.DB, p *Price) error {
+	s := "UPDATE price SET symbol = ?, date = ?, price = ?, currency_id = ? WHERE price_id = ?"
+	_, err := sqlexec(db, s, p.Symbol, p.Date, p.Price, p.Currencyid, p.Priceid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+func delPrice(db *sql.DB, priceid int64) error {
+	s := "DELETE FROM price WHERE price_id = ?"
+	_, err := sqlexec(db, s, priceid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func findPrice(db *sql.DB, priceid int64) (*Price, error) {
+	s := "SELECT price_id, symbol, date, price, currency_id FROM price WHERE price_id = ?"
+	row := db.QueryRow(s, priceid)
+	var p Price
+	err := row.Scan(&p.Priceid, &p.Symbol, &p.Date, &p.Price, &p.Currencyid)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Price history of a symbol, oldest first.
+func findPrices(db *sql.DB, symbol string) ([]*Price, error) {
+	s := "SELECT price_id, symbol, date, price, currency_id FROM price WHERE symbol = ? ORDER BY date, price_id"
+	rows, err := db.Query(s, symbol)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pp := []*Price{}
+	for rows.Next() {
+		var p Price
+		err := rows.Scan(&p.Priceid, &p.Symbol, &p.Date, &p.Price, &p.Currencyid)
+		if err != nil {
+			return nil, err
+		}
+		pp = append(pp, &p)
+	}
+	return pp, rows.Err()
+}
+
+// Latest price of symbol dated on or before date, in any currency.
+// Blank date returns the latest price. Returns nil if there's none.
+func latestPrice(db *sql.DB, symbol string, date string) (*Price, error) {
+	s := "SELECT price_id, symbol, date, price, currency_id FROM price WHERE symbol = ? AND (? = '' OR date <= ?) ORDER BY date DESC, price_id DESC LIMIT 1"
+	row := db.QueryRow(s, symbol, date, date)
+	var p Price
+	err := row.Scan(&p.Priceid, &p.Symbol, &p.Date, &p.Price, &p.Currencyid)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
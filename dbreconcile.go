@@ -0,0 +1,138 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//CREATE TABLE statement (statement_id INTEGER PRIMARY KEY NOT NULL, account_id INTEGER NOT NULL REFERENCES account(account_id) ON DELETE CASCADE, date TEXT NOT NULL, endbal INTEGER NOT NULL)
+
+// Bank statement an account was reconciled against.
+type Statement struct {
+	Statementid int64  `json:"statementid"`
+	Accountid   int64  `json:"accountid"`
+	Date        string `json:"date"`   // statement end date
+	Endbal      int64  `json:"endbal"` // ending balance, minor units of the account's currency
+}
+
+// Return error if any transaction matching cond is reconciled.
+func txcheckUnlocked(tx *sql.Tx, cond string, args ...interface{}) error {
+	var n int
+	s := fmt.Sprintf("SELECT COUNT(*) FROM trans WHERE status = %d AND (%s)", StatusReconciled, cond)
+	err := tx.QueryRow(s, args...).Scan(&n)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("Transaction is reconciled and can't be changed")
+	}
+	return nil
+}
+
+// Mark transaction uncleared or cleared. Reconciled transactions can only
+// be set back to cleared with unreconcileTrans().
+func setTransStatus(db *sql.DB, transid int64, status TransStatus) error {
+	if status == StatusReconciled {
+		return fmt.Errorf("Use finishReconcile() to reconcile transactions")
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = txcheckUnlocked(tx, "trans_id = ?", transid)
+	if err == nil {
+		_, err = txexec(tx, "UPDATE trans SET status = ? WHERE trans_id = ?", status, transid)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Unlock a reconciled transaction so it can be corrected. It goes back to
+// cleared.
+func unreconcileTrans(db *sql.DB, transid int64) error {
+	s := "UPDATE trans SET status = ? WHERE trans_id = ? AND status = ?"
+	_, err := sqlexec(db, s, StatusCleared, transid, StatusReconciled)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Transactions of an account not yet reconciled dated up to stmtdate,
+// ordered by date. These are the ones to tick off against a statement.
+func findUnreconciled(db *sql.DB, accountid int64, stmtdate string) ([]*Trans, error) {
+	s := "SELECT " + transCols + " FROM trans WHERE account_id = ? AND status <> ? AND date <= ? ORDER BY date, trans_id"
+	rows, err := db.Query(s, accountid, StatusReconciled, stmtdate)
+	if err != nil {
+		return nil, err
+	}
+	return scanTrans(rows)
+}
+
+// Statement ending balance minus the cleared balance. Reconciliation can
+// be finished when it is zero.
+func reconcileDiff(db *sql.DB, accountid int64, stmtdate string, endbal int64) Money {
+	cleared := balCleared(db, accountid, stmtdate)
+	return Money{endbal, cleared.Cur}.Sub(cleared)
+}
+
+// Lock the cleared transactions dated up to stmtdate as reconciled and
+// record the statement. Fails if the cleared balance doesn't equal endbal.
+func finishReconcile(db *sql.DB, accountid int64, stmtdate string, endbal int64) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	cleared, err := txbalCleared(tx, accountid, stmtdate)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	diff := Money{endbal, cleared.Cur}.Sub(cleared)
+	if !diff.IsZero() {
+		tx.Rollback()
+		return 0, fmt.Errorf("Cleared balance is off from the statement by %s", diff)
+	}
+	s := "UPDATE trans SET status = ? WHERE account_id = ? AND status = ? AND date <= ?"
+	_, err = txexec(tx, s, StatusReconciled, accountid, StatusCleared, stmtdate)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	s = "INSERT INTO statement (account_id, date, endbal) VALUES (?, ?, ?)"
+	result, err := txexec(tx, s, accountid, stmtdate, endbal)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Most recent statement of an account, or nil if it was never reconciled.
+func findLastStatement(db *sql.DB, accountid int64) (*Statement, error) {
+	s := "SELECT statement_id, account_id, date, endbal FROM statement WHERE account_id = ? ORDER BY date DESC, statement_id DESC LIMIT 1"
+	row := db.QueryRow(s, accountid)
+	var st Statement
+	err := row.Scan(&st.Statementid, &st.Accountid, &st.Date, &st.Endbal)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//CREATE TABLE schedule (schedule_id INTEGER PRIMARY KEY NOT NULL, account_id INTEGER NOT NULL REFERENCES account(account_id), ref TEXT NOT NULL DEFAULT '', desc TEXT NOT NULL DEFAULT '', amt INTEGER NOT NULL DEFAULT 0, category_id INTEGER REFERENCES category(category_id), payee_id INTEGER REFERENCES payee(payee_id), every INTEGER NOT NULL DEFAULT 1, unit INTEGER NOT NULL DEFAULT 0, lastbizday INTEGER NOT NULL DEFAULT 0, startdate TEXT NOT NULL, enddate TEXT NOT NULL DEFAULT '', count INTEGER NOT NULL DEFAULT 0, posted INTEGER NOT NULL DEFAULT 0)
+
+// Recurring transaction, ex. rent on the 1st of every month or salary
+// every 2 weeks. Occurrences start on Startdate and repeat every Every
+// Units. They stop after Enddate (blank for none) or after Count
+// occurrences (0 for no limit), whichever comes first.
+//
+// With Lastbizday set (monthly schedules only), occurrences fall on the last
+// weekday of the month instead of on Startdate's day of the month. If that
+// is before Startdate in the first month, ex. a start on Saturday the 31st,
+// that month is skipped and the schedule starts one period later.
+//
+// Posted is the number of occurrences already posted as transactions.
+type Schedule struct {
+	Scheduleid int64        `json:"scheduleid"`
+	Accountid  int64        `json:"accountid"`
+	Ref        string       `json:"ref"`
+	Desc       string       `json:"desc"`
+	Amt        int64        `json:"amt"`
+	Categoryid int64        `json:"categoryid"`
+	Payeeid    int64        `json:"payeeid"`
+	Every      int          `json:"every"`
+	Unit       ScheduleUnit `json:"unit"`
+	Lastbizday bool         `json:"lastbizday"`
+	Startdate  string       `json:"startdate"`
+	Enddate    string       `json:"enddate"`
+	Count      int          `json:"count"`
+	Posted     int          `json:"posted"`
+}
+
+type ScheduleUnit int
+
+const (
+	UnitDays ScheduleUnit = iota
+	UnitWeeks
+	UnitMonths
+)
+
+func (u ScheduleUnit) String() string {
+	switch u {
+	case UnitWeeks:
+		return "weeks"
+	case UnitMonths:
+		return "months"
+	}
+	return "days"
+}
+
+func checkSchedule(s *Schedule) error {
+	if !isDate(s.Startdate) {
+		return fmt.Errorf("Invalid start date '%s', use YYYY-MM-DD", s.Startdate)
+	}
+	if s.Enddate != "" && !isDate(s.Enddate) {
+		return fmt.Errorf("Invalid end date '%s', use YYYY-MM-DD", s.Enddate)
+	}
+	if s.Every < 1 {
+		return fmt.Errorf("Schedule must repeat every 1 or more %s", s.Unit)
+	}
+	if s.Count < 0 {
+		return fmt.Errorf("Schedule count can't be negative")
+	}
+	if s.Lastbizday && s.Unit != UnitMonths {
+		return fmt.Errorf("Last business day only applies to monthly schedules")
+	}
+	return nil
+}
+
+// Date n months after t. Days past the end of the target month are moved
+// back to its last day, ex. Jan 31 + 1 month is Feb 28 (or 29).
+func addMonths(t time.Time, n int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > last {
+		day = last
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, time.UTC)
+}
+
+// Last Monday to Friday of t's month.
+func lastBizDay(t time.Time) time.Time {
+	d := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC)
+	for d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+		d = d.AddDate(0, 0, -1)
+	}
+	return d
+}
+
+// Date of occurrence n, counting from 0, or "" if the schedule has ended
+// by then. Each occurrence is computed from the start date so that month
+// end clamping doesn't drift, ex. Jan 31, Feb 29, Mar 31.
+func (s *Schedule) Occurrence(n int) string {
+	if s.Count > 0 && n >= s.Count {
+		return ""
+	}
+	start, err := time.Parse(dateFormat, s.Startdate)
+	if err != nil || s.Every < 1 {
+		return ""
+	}
+	var t time.Time
+	switch s.Unit {
+	case UnitWeeks:
+		t = start.AddDate(0, 0, 7*s.Every*n)
+	case UnitMonths:
+		if s.Lastbizday && lastBizDay(start).Before(start) {
+			n++
+		}
+		t = addMonths(start, s.Every*n)
+		if s.Lastbizday {
+			t = lastBizDay(t)
+		}
+	default:
+		t = start.AddDate(0, 0, s.Every*n)
+	}
+	dt := t.Format(dateFormat)
+	if s.Enddate != "" && dt > s.Enddate {
+		return ""
+	}
+	return dt
+}
+
+// Date of the next occurrence to post, or "" if the schedule has ended.
+func (s *Schedule) Next() string {
+	return s.Occurrence(s.Posted)
+}
+
+const scheduleCols = "schedule_id, account_id, ref, desc, amt, IFNULL(category_id, 0), IFNULL(payee_id, 0), every, unit, lastbizday, startdate, enddate, count, posted"
+
+func scanScheduleRow(row rowScanner, s *Schedule) error {
+	return row.Scan(&s.Scheduleid, &s.Accountid, &s.Ref, &s.Desc, &s.Amt, &s.Categoryid, &s.Payeeid, &s.Every, &s.Unit, &s.Lastbizday, &s.Startdate, &s.Enddate, &s.Count, &s.Posted)
+}
+
+func createSchedule(db *sql.DB, s *Schedule) (int64, error) {
+	err := checkSchedule(s)
+	if err != nil {
+		return 0, err
+	}
+	q := "INSERT INTO schedule (account_id, ref, desc, amt, category_id, payee_id, every, unit, lastbizday, startdate, enddate, count, posted) VALUES (?, ?, ?, ?, NULLIF(?, 0), NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?)"
+	result, err := sqlexec(db, q, s.Accountid, s.Ref, s.Desc, s.Amt, s.Categoryid, s.Payeeid, s.Every, s.Unit, s.Lastbizday, s.Startdate, s.Enddate, s.Count, s.Posted)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+func editSchedule(db *sql.DB, s *Schedule) error {
+	err := checkSchedule(s)
+	if err != nil {
+		return err
+	}
+	q := "UPDATE schedule SET account_id = ?, ref = ?, desc = ?, amt = ?, category_id = NULLIF(?, 0), payee_id = NULLIF(?, 0), every = ?, unit = ?, lastbizday = ?, startdate = ?, enddate = ?, count = ?, posted = ? WHERE schedule_id = ?"
+	_, err = sqlexec(db, q, s.Accountid, s.Ref, s.Desc, s.Amt, s.Categoryid, s.Payeeid, s.Every, s.Unit, s.Lastbizday, s.Startdate, s.Enddate, s.Count, s.Posted, s.Scheduleid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Delete schedule. Transactions already posted from it are kept.
+func delSchedule(db *sql.DB, scheduleid int64) error {
+	s := "DELETE FROM schedule WHERE schedule_id = ?"
+	_, err := sqlexec(db, s, scheduleid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func findSchedule(db *sql.DB, scheduleid int64) (*Schedule, error) {
+	row := db.QueryRow("SELECT "+scheduleCols+" FROM schedule WHERE schedule_id = ?", scheduleid)
+	var s Schedule
+	err := scanScheduleRow(row, &s)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// All schedules ordered by start date. accountid 0 returns schedules of
+// all accounts.
+func findSchedules(db *sql.DB, accountid int64) ([]*Schedule, error) {
+	rows, err := db.Query("SELECT "+scheduleCols+" FROM schedule WHERE (?1 = 0 OR account_id = ?1) ORDER BY startdate, schedule_id", accountid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ss := []*Schedule{}
+	for rows.Next() {
+		var s Schedule
+		err := scanScheduleRow(rows, &s)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, &s)
+	}
+	return ss, rows.Err()
+}
+
+// Occurrence of a schedule not posted yet.
+type Due struct {
+	Schedule *Schedule `json:"schedule"`
+	Date     string    `json:"date"`
+}
+
+// Occurrences dated on or before asof that haven't been posted, ordered by
+// date. A schedule that is behind has one Due per missed occurrence.
+func findDue(db *sql.DB, asof string) ([]*Due, error) {
+	ss, err := findSchedules(db, 0)
+	if err != nil {
+		return nil, err
+	}
+	dd := []*Due{}
+	for _, s := range ss {
+		for n := s.Posted; ; n++ {
+			dt := s.Occurrence(n)
+			if dt == "" || dt > asof {
+				break
+			}
+			dd = append(dd, &Due{s, dt})
+		}
+	}
+	sort.SliceStable(dd, func(i, j int) bool {
+		return dd[i].Date < dd[j].Date
+	})
+	return dd, nil
+}
+
+// Post all occurrences due on or before asof as transactions, in one
+// transaction. Returns the number posted.
+func postDue(db *sql.DB, asof string) (int, error) {
+	dd, err := findDue(db, asof)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	for _, d := range dd {
+		err := txpostDue(tx, d)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return len(dd), nil
+}
+func txpostDue(tx *sql.Tx, d *Due) error {
+	s := d.Schedule
+	t := Trans{
+		Accountid:  s.Accountid,
+		Date:       d.Date,
+		Ref:        s.Ref,
+		Desc:       s.Desc,
+		Amt:        s.Amt,
+		Categoryid: s.Categoryid,
+		Payeeid:    s.Payeeid,
+	}
+	_, err := txcreateTrans(tx, &t)
+	if err != nil {
+		return err
+	}
+	_, err = txexec(tx, "UPDATE schedule SET posted = posted + 1 WHERE schedule_id = ?", s.Scheduleid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAddMonths(t *testing.T) {
+	tests := []struct {
+		date string
+		n    int
+		want string
+	}{
+		{"2024-01-15", 1, "2024-02-15"},
+		{"2024-01-31", 1, "2024-02-29"},
+		{"2023-01-31", 1, "2023-02-28"},
+		{"2024-03-31", 1, "2024-04-30"},
+		{"2024-11-30", 2, "2025-01-30"},
+		{"2024-01-31", 12, "2025-01-31"},
+		{"2024-03-31", -1, "2024-02-29"},
+	}
+	for _, tt := range tests {
+		d, _ := time.Parse(dateFormat, tt.date)
+		got := addMonths(d, tt.n).Format(dateFormat)
+		if got != tt.want {
+			t.Errorf("addMonths(%s, %d) = %s, want %s", tt.date, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestLastBizDay(t *testing.T) {
+	tests := []struct {
+		date string
+		want string
+	}{
+		{"2024-01-10", "2024-01-31"}, // Wednesday
+		{"2024-08-01", "2024-08-30"}, // 31st is a Saturday
+		{"2024-03-05", "2024-03-29"}, // 31st is a Sunday
+		{"2024-02-29", "2024-02-29"}, // Thursday, leap day
+		{"2025-05-31", "2025-05-30"},
+	}
+	for _, tt := range tests {
+		d, _ := time.Parse(dateFormat, tt.date)
+		got := lastBizDay(d).Format(dateFormat)
+		if got != tt.want {
+			t.Errorf("lastBizDay(%s) = %s, want %s", tt.date, got, tt.want)
+		}
+	}
+}
+
+func TestScheduleOccurrence(t *testing.T) {
+	tests := []struct {
+		name string
+		s    Schedule
+		want []string // occurrences 0, 1, ... up to the first ""
+	}{
+		{"daily",
+			Schedule{Startdate: "2024-01-30", Every: 1, Unit: UnitDays, Count: 3},
+			[]string{"2024-01-30", "2024-01-31", "2024-02-01", ""}},
+		{"every 2 weeks",
+			Schedule{Startdate: "2024-01-05", Every: 2, Unit: UnitWeeks, Enddate: "2024-02-16"},
+			[]string{"2024-01-05", "2024-01-19", "2024-02-02", "2024-02-16", ""}},
+		{"month end doesn't drift",
+			Schedule{Startdate: "2024-01-31", Every: 1, Unit: UnitMonths, Count: 4},
+			[]string{"2024-01-31", "2024-02-29", "2024-03-31", "2024-04-30", ""}},
+		{"quarterly",
+			Schedule{Startdate: "2024-11-15", Every: 3, Unit: UnitMonths, Enddate: "2025-06-01"},
+			[]string{"2024-11-15", "2025-02-15", "2025-05-15", ""}},
+		{"last weekday",
+			Schedule{Startdate: "2024-01-01", Every: 1, Unit: UnitMonths, Lastbizday: true, Count: 3},
+			[]string{"2024-01-31", "2024-02-29", "2024-03-29", ""}},
+		{"last weekday before start is skipped",
+			Schedule{Startdate: "2024-08-31", Every: 1, Unit: UnitMonths, Lastbizday: true, Count: 2},
+			[]string{"2024-09-30", "2024-10-31", ""}},
+		{"last weekday on start",
+			Schedule{Startdate: "2024-08-30", Every: 1, Unit: UnitMonths, Lastbizday: true, Count: 2},
+			[]string{"2024-08-30", "2024-09-30", ""}},
+		{"end date before start",
+			Schedule{Startdate: "2024-05-01", Every: 1, Unit: UnitMonths, Enddate: "2024-04-30"},
+			[]string{""}},
+		{"invalid start date",
+			Schedule{Startdate: "2024-13-01", Every: 1, Unit: UnitMonths},
+			[]string{""}},
+	}
+	for _, tt := range tests {
+		for n, want := range tt.want {
+			got := tt.s.Occurrence(n)
+			if got != want {
+				t.Errorf("%s: Occurrence(%d) = %q, want %q", tt.name, n, got, want)
+			}
+		}
+	}
+}
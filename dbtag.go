@@ -0,0 +1,232 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//CREATE TABLE tag (tag_id INTEGER PRIMARY KEY NOT NULL, name TEXT NOT NULL UNIQUE COLLATE NOCASE)
+//CREATE TABLE transtag (trans_id INTEGER NOT NULL REFERENCES trans(trans_id) ON DELETE CASCADE, tag_id INTEGER NOT NULL REFERENCES tag(tag_id) ON DELETE CASCADE, PRIMARY KEY (trans_id, tag_id))
+
+// Free-form label on transactions, ex. "vacation-2026". A transaction can
+// have any number of tags. Tag names are matched ignoring case.
+type Tag struct {
+	Tagid int64  `json:"tagid"`
+	Name  string `json:"name"`
+}
+
+func checkTagName(name string) error {
+	if name == "" {
+		return fmt.Errorf("Tag name is blank")
+	}
+	if strings.ContainsAny(name, " \t\n") {
+		return fmt.Errorf("Tag name '%s' can't contain spaces", name)
+	}
+	return nil
+}
+
+// Find tag by name, creating it if there's none.
+func txcreateTag(tx *sql.Tx, name string) (int64, error) {
+	err := checkTagName(name)
+	if err != nil {
+		return 0, err
+	}
+	var id int64
+	err = tx.QueryRow("SELECT tag_id FROM tag WHERE name = ?", name).Scan(&id)
+	if err == nil {
+		return id, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+	result, err := txexec(tx, "INSERT INTO tag (name) VALUES (?)", name)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// Rename tag.
+func editTag(db *sql.DB, t *Tag) error {
+	err := checkTagName(t.Name)
+	if err != nil {
+		return err
+	}
+	s := "UPDATE tag SET name = ? WHERE tag_id = ?"
+	_, err = sqlexec(db, s, t.Name, t.Tagid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Delete tag, removing it from all transactions.
+func delTag(db *sql.DB, tagid int64) error {
+	s := "DELETE FROM tag WHERE tag_id = ?"
+	_, err := sqlexec(db, s, tagid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Tag transaction, creating the tag if needed. Adding a tag the
+// transaction already has does nothing.
+func addTransTag(db *sql.DB, transid int64, name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = txaddTransTag(tx, transid, name)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+func txaddTransTag(tx *sql.Tx, transid int64, name string) error {
+	tagid, err := txcreateTag(tx, name)
+	if err != nil {
+		return err
+	}
+	s := "INSERT OR IGNORE INTO transtag (trans_id, tag_id) VALUES (?, ?)"
+	_, err = txexec(tx, s, transid, tagid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Remove tag from transaction. The tag itself is kept.
+func removeTransTag(db *sql.DB, transid int64, name string) error {
+	s := "DELETE FROM transtag WHERE trans_id = ? AND tag_id IN (SELECT tag_id FROM tag WHERE name = ?)"
+	_, err := sqlexec(db, s, transid, name)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func findTag(db *sql.DB, tagid int64) (*Tag, error) {
+	s := "SELECT tag_id, name FROM tag WHERE tag_id = ?"
+	row := db.QueryRow(s, tagid)
+	var t Tag
+	err := row.Scan(&t.Tagid, &t.Name)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Find tag by name, ignoring case.
+func findTagByName(db *sql.DB, name string) (*Tag, error) {
+	s := "SELECT tag_id, name FROM tag WHERE name = ?"
+	row := db.QueryRow(s, name)
+	var t Tag
+	err := row.Scan(&t.Tagid, &t.Name)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// All tags ordered by name.
+func findTags(db *sql.DB) ([]*Tag, error) {
+	rows, err := db.Query("SELECT tag_id, name FROM tag ORDER BY name, tag_id")
+	if err != nil {
+		return nil, err
+	}
+	return scanTags(rows)
+}
+
+// Tags of a transaction ordered by name.
+func findTransTags(db *sql.DB, transid int64) ([]*Tag, error) {
+	s := "SELECT g.tag_id, g.name FROM tag g INNER JOIN transtag tt ON tt.tag_id = g.tag_id WHERE tt.trans_id = ? ORDER BY g.name, g.tag_id"
+	rows, err := db.Query(s, transid)
+	if err != nil {
+		return nil, err
+	}
+	return scanTags(rows)
+}
+
+func scanTags(rows *sql.Rows) ([]*Tag, error) {
+	defer rows.Close()
+	tt := []*Tag{}
+	for rows.Next() {
+		var t Tag
+		err := rows.Scan(&t.Tagid, &t.Name)
+		if err != nil {
+			return nil, err
+		}
+		tt = append(tt, &t)
+	}
+	return tt, rows.Err()
+}
+
+// Transactions in any account with tag name dated from startdt to enddt
+// inclusive, ordered by date. An empty startdt or enddt leaves that end of
+// the range open.
+func findTransByTag(db *sql.DB, name, startdt, enddt string) ([]*Trans, error) {
+	s := "SELECT " + transCols + ` FROM trans WHERE trans_id IN (SELECT tt.trans_id FROM transtag tt INNER JOIN tag g ON g.tag_id = tt.tag_id WHERE g.name = ?)
+AND (? = '' OR date >= ?) AND (? = '' OR date <= ?) ORDER BY date, trans_id`
+	rows, err := db.Query(s, name, startdt, startdt, enddt, enddt)
+	if err != nil {
+		return nil, err
+	}
+	return scanTrans(rows)
+}
+
+// Total of the transactions with a tag.
+type TagTotal struct {
+	Tag *Tag  `json:"tag"`
+	Amt Money `json:"amt"`
+}
+
+// Totals of transactions dated from startdt to enddt (blank for open
+// ended) by tag, in currency repcur at the rate on each transaction's date,
+// ordered by tag name. A transaction with several tags counts toward each
+// of them.
+func findTagTotals(db *sql.DB, repcur *Currency, startdt, enddt string) ([]*TagTotal, error) {
+	cv, err := newConverter(db)
+	if err != nil {
+		return nil, err
+	}
+	s := `SELECT g.tag_id, g.name, a.currency_id, t.date, SUM(t.amt) FROM trans t
+INNER JOIN transtag tt ON tt.trans_id = t.trans_id INNER JOIN tag g ON g.tag_id = tt.tag_id INNER JOIN account a ON a.account_id = t.account_id
+WHERE (?1 = '' OR t.date >= ?1) AND (?2 = '' OR t.date <= ?2)
+GROUP BY g.tag_id, a.currency_id, t.date ORDER BY g.name, g.tag_id`
+	rows, err := db.Query(s, startdt, enddt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	gtt := []*TagTotal{}
+	for rows.Next() {
+		var g Tag
+		var currencyid, sum int64
+		var date string
+		err := rows.Scan(&g.Tagid, &g.Name, &currencyid, &date, &sum)
+		if err != nil {
+			return nil, err
+		}
+		m, err := cv.ConvertAsOf(Money{sum, cv.curs[currencyid]}, repcur, date)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(gtt); n > 0 && gtt[n-1].Tag.Tagid == g.Tagid {
+			gtt[n-1].Amt = gtt[n-1].Amt.Add(m)
+			continue
+		}
+		gtt = append(gtt, &TagTotal{&g, m})
+	}
+	return gtt, rows.Err()
+}
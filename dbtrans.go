@@ -0,0 +1,270 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//CREATE TABLE trans (trans_id INTEGER PRIMARY KEY NOT NULL, account_id INTEGER NOT NULL REFERENCES account(account_id), date TEXT, ref TEXT, desc TEXT, amt INTEGER NOT NULL DEFAULT 0, symbol TEXT NOT NULL DEFAULT '', qty INTEGER NOT NULL DEFAULT 0, price INTEGER NOT NULL DEFAULT 0, journal_id INTEGER REFERENCES journal(journal_id), category_id INTEGER REFERENCES category(category_id), payee_id INTEGER REFERENCES payee(payee_id), status INTEGER NOT NULL DEFAULT 0)
+
+// Symbol, Qty and Price are only used in accounts whose type tracks shares.
+// Qty is positive for buys and negative for sells. Amt is the cash amount
+// of the trade, usually Qty * Price plus fees.
+//
+// A trans is one posting of a journal entry (see Journal). Journalid is 0 for
+// single-entry transactions that haven't been converted to double-entry.
+type Trans struct {
+	Transid    int64       `json:"transid"`
+	Accountid  int64       `json:"accountid"`
+	Date       string      `json:"date"`
+	Ref        string      `json:"ref"`
+	Desc       string      `json:"desc"`
+	Amt        int64       `json:"amt"` // minor units of the account's currency
+	Symbol     string      `json:"symbol"`
+	Qty        Fixed       `json:"qty"`
+	Price      Fixed       `json:"price"` // per share, in the account's currency
+	Journalid  int64       `json:"journalid"`
+	Categoryid int64       `json:"categoryid"` // 0 for none
+	Payeeid    int64       `json:"payeeid"`    // 0 for none
+	Status     TransStatus `json:"status"`
+}
+
+// Whether a transaction has shown up on a bank statement. Reconciled
+// transactions are locked: they can't be edited or deleted.
+type TransStatus int
+
+const (
+	StatusUncleared  TransStatus = iota
+	StatusCleared                // ticked off against a statement
+	StatusReconciled             // part of a finished reconciliation
+)
+
+func (st TransStatus) String() string {
+	switch st {
+	case StatusCleared:
+		return "Cleared"
+	case StatusReconciled:
+		return "Reconciled"
+	}
+	return "Uncleared"
+}
+
+// One letter mark for registers: blank, 'c' or 'R'.
+func (st TransStatus) Mark() string {
+	switch st {
+	case StatusCleared:
+		return "c"
+	case StatusReconciled:
+		return "R"
+	}
+	return " "
+}
+
+func createTrans(db *sql.DB, t *Trans) (int64, error) {
+	s := "INSERT INTO trans (account_id, date, ref, desc, amt, symbol, qty, price, journal_id, category_id, payee_id, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, 0), ?)"
+	result, err := sqlexec(db, s, t.Accountid, t.Date, t.Ref, t.Desc, t.Amt, t.Symbol, t.Qty, t.Price, t.Journalid, t.Categoryid, t.Payeeid, t.Status)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+func txcreateTrans(tx *sql.Tx, t *Trans) (int64, error) {
+	s := "INSERT INTO trans (account_id, date, ref, desc, amt, symbol, qty, price, journal_id, category_id, payee_id, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), NULLIF(?, 0), NULLIF(?, 0), ?)"
+	result, err := txexec(tx, s, t.Accountid, t.Date, t.Ref, t.Desc, t.Amt, t.Symbol, t.Qty, t.Price, t.Journalid, t.Categoryid, t.Payeeid, t.Status)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Update transaction. If it is one leg of a transfer, the other leg is
+// updated to match. If it is a posting of a journal entry, the other
+// postings take its date and ref and the entry must still balance.
+func editTrans(db *sql.DB, t *Trans) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = txeditTrans(tx, t)
+	if err == nil {
+		err = txsyncTransfer(tx, t)
+	}
+	if err == nil {
+		err = txsyncJournal(tx, t)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Status isn't changed, use setTransStatus() for that.
+func txeditTrans(tx *sql.Tx, t *Trans) error {
+	err := txcheckUnlocked(tx, "trans_id = ?", t.Transid)
+	if err != nil {
+		return err
+	}
+	s := "UPDATE trans SET account_id = ?, date = ?, ref = ?, desc = ?, amt = ?, symbol = ?, qty = ?, price = ?, category_id = NULLIF(?, 0), payee_id = NULLIF(?, 0) WHERE trans_id = ?"
+	_, err = txexec(tx, s, t.Accountid, t.Date, t.Ref, t.Desc, t.Amt, t.Symbol, t.Qty, t.Price, t.Categoryid, t.Payeeid, t.Transid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Delete transaction. Deleting either leg of a transfer deletes both, and
+// deleting a posting of a journal entry deletes the whole entry.
+func delTrans(db *sql.DB, transid int64) error {
+	x, err := findTransferByTrans(db, transid)
+	if err != nil {
+		return err
+	}
+	if x != nil {
+		return delTransfer(db, x.Transferid)
+	}
+	t, err := findTrans(db, transid)
+	if err != nil {
+		return err
+	}
+	if t != nil && t.Journalid != 0 {
+		return delJournal(db, t.Journalid)
+	}
+	if t != nil && t.Status == StatusReconciled {
+		return fmt.Errorf("Transaction is reconciled and can't be changed")
+	}
+
+	s := "DELETE FROM trans WHERE trans_id = ?"
+	_, err = sqlexec(db, s, transid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+const transCols = "trans_id, account_id, date, ref, desc, amt, symbol, qty, price, IFNULL(journal_id, 0), IFNULL(category_id, 0), IFNULL(payee_id, 0), status"
+
+// Scan destinations for transCols.
+func transDest(t *Trans) []interface{} {
+	return []interface{}{&t.Transid, &t.Accountid, &t.Date, &t.Ref, &t.Desc, &t.Amt, &t.Symbol, &t.Qty, &t.Price, &t.Journalid, &t.Categoryid, &t.Payeeid, &t.Status}
+}
+
+// Scan transCols into t.
+func scanTransRow(row rowScanner, t *Trans) error {
+	return row.Scan(transDest(t)...)
+}
+
+func scanTrans(rows *sql.Rows) ([]*Trans, error) {
+	defer rows.Close()
+	tt := []*Trans{}
+	for rows.Next() {
+		var t Trans
+		err := scanTransRow(rows, &t)
+		if err != nil {
+			return nil, err
+		}
+		tt = append(tt, &t)
+	}
+	return tt, rows.Err()
+}
+
+func findTrans(db *sql.DB, transid int64) (*Trans, error) {
+	s := "SELECT " + transCols + " FROM trans WHERE trans_id = ?"
+	row := db.QueryRow(s, transid)
+	var t Trans
+	err := scanTransRow(row, &t)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Transactions of an account, oldest first.
+func findTransByAccount(db *sql.DB, accountid int64) ([]*Trans, error) {
+	s := "SELECT " + transCols + " FROM trans WHERE account_id = ? ORDER BY date, trans_id"
+	rows, err := db.Query(s, accountid)
+	if err != nil {
+		return nil, err
+	}
+	return scanTrans(rows)
+}
+
+// Transactions dated from startdt to enddt inclusive (YYYY-MM-DD).
+// An empty startdt or enddt leaves that end of the range open.
+// Pass accountid 0 to include all accounts.
+func findTransByDate(db *sql.DB, accountid int64, startdt, enddt string) ([]*Trans, error) {
+	s := "SELECT " + transCols + " FROM trans WHERE (? = 0 OR account_id = ?) AND (? = '' OR date >= ?) AND (? = '' OR date <= ?) ORDER BY date, trans_id"
+	rows, err := db.Query(s, accountid, accountid, startdt, startdt, enddt, enddt)
+	if err != nil {
+		return nil, err
+	}
+	return scanTrans(rows)
+}
+
+// Transactions of an account having the given ref (ex. check number).
+func findTransByRef(db *sql.DB, accountid int64, ref string) ([]*Trans, error) {
+	s := "SELECT " + transCols + " FROM trans WHERE account_id = ? AND ref = ? ORDER BY date, trans_id"
+	rows, err := db.Query(s, accountid, ref)
+	if err != nil {
+		return nil, err
+	}
+	return scanTrans(rows)
+}
+
+// Sum of an account's transaction amounts in minor units, for transactions
+// dated from startdt to enddt inclusive. An empty startdt or enddt leaves
+// that end of the range open.
+func sumTrans(db *sql.DB, accountid int64, startdt, enddt string) (int64, error) {
+	s := "SELECT IFNULL(SUM(amt), 0) FROM trans WHERE account_id = ? AND (? = '' OR date >= ?) AND (? = '' OR date <= ?)"
+	row := db.QueryRow(s, accountid, startdt, startdt, enddt, enddt)
+	var sum int64
+	err := row.Scan(&sum)
+	if err != nil {
+		return 0, err
+	}
+	return sum, nil
+}
+
+// Transaction in an account register with the account balance after it.
+type RegisterEntry struct {
+	Trans *Trans `json:"trans"`
+	Bal   Money  `json:"bal"`
+}
+
+// Transactions of an account with running balance, ordered by date.
+// Transactions on the same day are in the order they were entered.
+func findRegister(db *sql.DB, accountid int64) ([]*RegisterEntry, error) {
+	cur, err := findAccountCurrency(db, accountid)
+	if err != nil {
+		return nil, err
+	}
+	s := "SELECT " + transCols + ", SUM(amt) OVER (ORDER BY date, trans_id ROWS UNBOUNDED PRECEDING) FROM trans WHERE account_id = ? ORDER BY date, trans_id"
+	rows, err := db.Query(s, accountid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ee := []*RegisterEntry{}
+	for rows.Next() {
+		var t Trans
+		var bal int64
+		err := rows.Scan(append(transDest(&t), &bal)...)
+		if err != nil {
+			return nil, err
+		}
+		ee = append(ee, &RegisterEntry{&t, Money{bal, cur}})
+	}
+	return ee, rows.Err()
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"math/big"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+//CREATE TABLE transfer (transfer_id INTEGER PRIMARY KEY NOT NULL, from_trans_id INTEGER NOT NULL UNIQUE REFERENCES trans(trans_id), to_trans_id INTEGER NOT NULL UNIQUE REFERENCES trans(trans_id), rate REAL NOT NULL DEFAULT 1.0)
+
+// Money moved from one account to another, stored as two linked trans
+// rows: a withdrawal of Fromamt and a deposit of Toamt. The legs share
+// date, ref and desc.
+//
+// For accounts in different currencies both amounts are recorded and Rate
+// is the implied exchange rate, units of the to currency per unit of the
+// from currency. For the same currency Toamt equals Fromamt and Rate is 1.
+//
+// The legs are postings of one journal entry. A transfer between currencies
+// is balanced with postings to each currency's exchange account.
+type Transfer struct {
+	Transferid    int64   `json:"transferid"`
+	Date          string  `json:"date"`
+	Ref           string  `json:"ref"`
+	Desc          string  `json:"desc"`
+	Fromaccountid int64   `json:"fromaccountid"`
+	Toaccountid   int64   `json:"toaccountid"`
+	Fromamt       int64   `json:"fromamt"` // positive, minor units of the from account
+	Toamt         int64   `json:"toamt"`   // positive, minor units of the to account
+	Rate          float64 `json:"rate"`
+	Fromtransid   int64   `json:"fromtransid"`
+	Totransid     int64   `json:"totransid"`
+}
+
+// Check the transfer's accounts and amounts, filling in Toamt and Rate.
+func txprepTransfer(tx *sql.Tx, x *Transfer) error {
+	if x.Fromaccountid == x.Toaccountid {
+		return fmt.Errorf("transfer from and to the same account")
+	}
+	if x.Fromamt <= 0 {
+		return fmt.Errorf("transfer amount must be positive")
+	}
+
+	fromcur, err := txfindAccountCurrency(tx, x.Fromaccountid)
+	if err != nil {
+		return err
+	}
+	if fromcur == nil {
+		return fmt.Errorf("account %d doesn't exist", x.Fromaccountid)
+	}
+	tocur, err := txfindAccountCurrency(tx, x.Toaccountid)
+	if err != nil {
+		return err
+	}
+	if tocur == nil {
+		return fmt.Errorf("account %d doesn't exist", x.Toaccountid)
+	}
+
+	if fromcur.Currencyid == tocur.Currencyid {
+		if x.Toamt != 0 && x.Toamt != x.Fromamt {
+			return fmt.Errorf("transfer between %s accounts must have the same from and to amounts", fromcur.Name)
+		}
+		x.Toamt = x.Fromamt
+		x.Rate = 1.0
+		return nil
+	}
+	if x.Toamt <= 0 {
+		return fmt.Errorf("transfer from %s to %s needs both amounts", fromcur.Name, tocur.Name)
+	}
+	r := new(big.Rat).Quo(Money{x.Toamt, tocur}.Rat(), Money{x.Fromamt, fromcur}.Rat())
+	x.Rate, _ = r.Float64()
+	return nil
+}
+
+func createTransfer(db *sql.DB, x *Transfer) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	id, err := txcreateTransfer(tx, x)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+func txcreateTransfer(tx *sql.Tx, x *Transfer) (int64, error) {
+	err := txprepTransfer(tx, x)
+	if err != nil {
+		return 0, err
+	}
+	journalid, err := txnewJournal(tx)
+	if err != nil {
+		return 0, err
+	}
+	from := Trans{Accountid: x.Fromaccountid, Date: x.Date, Ref: x.Ref, Desc: x.Desc, Amt: -x.Fromamt, Journalid: journalid}
+	x.Fromtransid, err = txcreateTrans(tx, &from)
+	if err != nil {
+		return 0, err
+	}
+	to := Trans{Accountid: x.Toaccountid, Date: x.Date, Ref: x.Ref, Desc: x.Desc, Amt: x.Toamt, Journalid: journalid}
+	x.Totransid, err = txcreateTrans(tx, &to)
+	if err != nil {
+		return 0, err
+	}
+	err = txpostExchange(tx, journalid, x)
+	if err != nil {
+		return 0, err
+	}
+
+	s := "INSERT INTO transfer (from_trans_id, to_trans_id, rate) VALUES (?, ?, ?)"
+	result, err := txexec(tx, s, x.Fromtransid, x.Totransid, x.Rate)
+	if err != nil {
+		return 0, err
+	}
+	x.Transferid, err = result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return x.Transferid, nil
+}
+
+// Replace the exchange postings of a transfer's journal entry. Transfers
+// within one currency have none. Otherwise the from currency's exchange
+// account takes Fromamt and the to currency's gives Toamt, so each
+// currency's postings sum to zero.
+func txpostExchange(tx *sql.Tx, journalid int64, x *Transfer) error {
+	s := "DELETE FROM trans WHERE journal_id = ? AND trans_id NOT IN (?, ?)"
+	_, err := txexec(tx, s, journalid, x.Fromtransid, x.Totransid)
+	if err != nil {
+		return err
+	}
+	fromcur, err := txfindAccountCurrency(tx, x.Fromaccountid)
+	if err != nil {
+		return err
+	}
+	tocur, err := txfindAccountCurrency(tx, x.Toaccountid)
+	if err != nil {
+		return err
+	}
+	if fromcur.Currencyid == tocur.Currencyid {
+		return txcheckJournal(tx, journalid)
+	}
+
+	fromexch, err := txexchangeAccount(tx, fromcur)
+	if err != nil {
+		return err
+	}
+	toexch, err := txexchangeAccount(tx, tocur)
+	if err != nil {
+		return err
+	}
+	t := Trans{Accountid: fromexch, Date: x.Date, Ref: x.Ref, Desc: x.Desc, Amt: x.Fromamt, Journalid: journalid}
+	_, err = txcreateTrans(tx, &t)
+	if err != nil {
+		return err
+	}
+	t = Trans{Accountid: toexch, Date: x.Date, Ref: x.Ref, Desc: x.Desc, Amt: -x.Toamt, Journalid: journalid}
+	_, err = txcreateTrans(tx, &t)
+	if err != nil {
+		return err
+	}
+	return txcheckJournal(tx, journalid)
+}
+
+// Update both legs of a transfer.
+func editTransfer(db *sql.DB, x *Transfer) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = txeditTransfer(tx, x)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+func txeditTransfer(tx *sql.Tx, x *Transfer) error {
+	var fromtransid, totransid int64
+	s := "SELECT from_trans_id, to_trans_id FROM transfer WHERE transfer_id = ?"
+	err := tx.QueryRow(s, x.Transferid).Scan(&fromtransid, &totransid)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("transfer %d doesn't exist", x.Transferid)
+	}
+	if err != nil {
+		return err
+	}
+	x.Fromtransid, x.Totransid = fromtransid, totransid
+	err = txcheckUnlocked(tx, "trans_id IN (?, ?)", fromtransid, totransid)
+	if err != nil {
+		return err
+	}
+
+	err = txprepTransfer(tx, x)
+	if err != nil {
+		return err
+	}
+	s = "UPDATE trans SET account_id = ?, date = ?, ref = ?, desc = ?, amt = ? WHERE trans_id = ?"
+	_, err = txexec(tx, s, x.Fromaccountid, x.Date, x.Ref, x.Desc, -x.Fromamt, x.Fromtransid)
+	if err != nil {
+		return err
+	}
+	_, err = txexec(tx, s, x.Toaccountid, x.Date, x.Ref, x.Desc, x.Toamt, x.Totransid)
+	if err != nil {
+		return err
+	}
+	_, err = txexec(tx, "UPDATE transfer SET rate = ? WHERE transfer_id = ?", x.Rate, x.Transferid)
+	if err != nil {
+		return err
+	}
+
+	// Transfers made before double-entry have no journal entry until
+	// converted.
+	var journalid int64
+	err = tx.QueryRow("SELECT IFNULL(journal_id, 0) FROM trans WHERE trans_id = ?", x.Fromtransid).Scan(&journalid)
+	if err != nil {
+		return err
+	}
+	if journalid == 0 {
+		return nil
+	}
+	return txpostExchange(tx, journalid, x)
+}
+
+// Delete transfer, both its legs and its journal entry.
+func delTransfer(db *sql.DB, transferid int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = txdelTransfer(tx, transferid)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+func txdelTransfer(tx *sql.Tx, transferid int64) error {
+	var fromtransid, totransid int64
+	s := "SELECT from_trans_id, to_trans_id FROM transfer WHERE transfer_id = ?"
+	err := tx.QueryRow(s, transferid).Scan(&fromtransid, &totransid)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var journalid int64
+	err = tx.QueryRow("SELECT IFNULL(journal_id, 0) FROM trans WHERE trans_id = ?", fromtransid).Scan(&journalid)
+	if err != nil {
+		return err
+	}
+	err = txcheckUnlocked(tx, "trans_id IN (?, ?) OR journal_id = ?", fromtransid, totransid, journalid)
+	if err != nil {
+		return err
+	}
+	_, err = txexec(tx, "DELETE FROM transfer WHERE transfer_id = ?", transferid)
+	if err != nil {
+		return err
+	}
+	_, err = txexec(tx, "DELETE FROM trans WHERE trans_id IN (?, ?) OR journal_id = ?", fromtransid, totransid, journalid)
+	if err != nil {
+		return err
+	}
+	_, err = txexec(tx, "DELETE FROM journal WHERE journal_id = ?", journalid)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// After one leg t of a transfer was edited, update the other leg and the
+// rate to match. Between accounts of the same currency the other leg's
+// amount follows; otherwise it is kept and the rate recomputed.
+// Does nothing if t isn't part of a transfer.
+func txsyncTransfer(tx *sql.Tx, t *Trans) error {
+	x, err := txfindTransferByTrans(tx, t.Transid)
+	if err != nil {
+		return err
+	}
+	if x == nil {
+		return nil
+	}
+	x.Date, x.Ref, x.Desc = t.Date, t.Ref, t.Desc
+	if t.Transid == x.Fromtransid {
+		x.Fromaccountid = t.Accountid
+		x.Fromamt = -t.Amt
+	} else {
+		x.Toaccountid = t.Accountid
+		x.Toamt = t.Amt
+	}
+
+	var samecur bool
+	s := "SELECT (SELECT currency_id FROM account WHERE account_id = ?) = (SELECT currency_id FROM account WHERE account_id = ?)"
+	err = tx.QueryRow(s, x.Fromaccountid, x.Toaccountid).Scan(&samecur)
+	if err != nil {
+		return err
+	}
+	if samecur {
+		if t.Transid == x.Fromtransid {
+			x.Toamt = x.Fromamt
+		} else {
+			x.Fromamt = x.Toamt
+		}
+	}
+	return txeditTransfer(tx, x)
+}
+
+const transferSelect = `SELECT x.transfer_id, f.date, f.ref, f.desc, f.account_id, t.account_id, -f.amt, t.amt, x.rate, x.from_trans_id, x.to_trans_id
+FROM transfer x INNER JOIN trans f ON f.trans_id = x.from_trans_id INNER JOIN trans t ON t.trans_id = x.to_trans_id`
+
+func scanTransferRow(row rowScanner, x *Transfer) error {
+	return row.Scan(&x.Transferid, &x.Date, &x.Ref, &x.Desc, &x.Fromaccountid, &x.Toaccountid, &x.Fromamt, &x.Toamt, &x.Rate, &x.Fromtransid, &x.Totransid)
+}
+
+func findTransfer(db *sql.DB, transferid int64) (*Transfer, error) {
+	row := db.QueryRow(transferSelect+" WHERE x.transfer_id = ?", transferid)
+	var x Transfer
+	err := scanTransferRow(row, &x)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &x, nil
+}
+
+// Transfer having transid as one of its legs, or nil.
+func findTransferByTrans(db *sql.DB, transid int64) (*Transfer, error) {
+	row := db.QueryRow(transferSelect+" WHERE x.from_trans_id = ?1 OR x.to_trans_id = ?1", transid)
+	var x Transfer
+	err := scanTransferRow(row, &x)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &x, nil
+}
+func txfindTransferByTrans(tx *sql.Tx, transid int64) (*Transfer, error) {
+	row := tx.QueryRow(transferSelect+" WHERE x.from_trans_id = ?1 OR x.to_trans_id = ?1", transid)
+	var x Transfer
+	err := scanTransferRow(row, &x)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &x, nil
+}
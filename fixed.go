@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Fixed point number with 6 decimals, ex. Fixed(1500000) is 1.5
+// Used for share quantities and prices per share, which need more precision
+// than a currency's minor unit and must still add up exactly.
+type Fixed int64
+
+const fixedDecimals = 6
+
+func (f Fixed) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(int64(f)), pow10(fixedDecimals))
+}
+
+func fixedFromRat(r *big.Rat, mode RoundingMode) Fixed {
+	units := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(fixedDecimals)))
+	return Fixed(roundRat(units, mode))
+}
+
+// Parse number such as "1,250" or "12.3456". Digits past the sixth decimal
+// are rounded half up.
+func parseFixed(s string) (Fixed, error) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	for _, c := range s {
+		if !(c >= '0' && c <= '9') && c != '.' && c != '-' && c != '+' {
+			return 0, fmt.Errorf("invalid number '%s'", s)
+		}
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return 0, fmt.Errorf("invalid number '%s'", s)
+	}
+	return fixedFromRat(r, RoundHalfUp), nil
+}
+
+// Format without trailing zero decimals, ex. "1250" or "12.3456".
+func (f Fixed) String() string {
+	s := f.Rat().FloatString(fixedDecimals)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+	return s
+}
+
+// Amount of qty shares at price per share, rounded to the currency.
+func stockAmt(qty, price Fixed, cur *Currency) Money {
+	r := new(big.Rat).Mul(qty.Rat(), price.Rat())
+	return moneyFromRat(r, cur, RoundHalfUp)
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+func checkCSVMapping(m *CSVMapping) error {
+	if m.Datecol == "" {
+		return fmt.Errorf("CSV mapping needs a date column")
+	}
+	if m.Amtcol == "" && m.Debitcol == "" && m.Creditcol == "" {
+		return fmt.Errorf("CSV mapping needs an amount column, or debit and credit columns")
+	}
+	if m.Amtcol != "" && (m.Debitcol != "" || m.Creditcol != "") {
+		return fmt.Errorf("CSV mapping can't have both an amount column and debit/credit columns")
+	}
+	if m.Decimalsep != "." && m.Decimalsep != "," {
+		return fmt.Errorf("Invalid decimal separator '%s', use '.' or ','", m.Decimalsep)
+	}
+	if _, err := csvDelimiter(m.Delimiter); err != nil {
+		return err
+	}
+	if m.Skip < 0 {
+		return fmt.Errorf("Lines to skip can't be negative")
+	}
+	return nil
+}
+
+// Field separator rune. "tab" can be used for tab separated files.
+func csvDelimiter(s string) (rune, error) {
+	if s == "tab" || s == `\t` {
+		return '\t', nil
+	}
+	r, n := utf8.DecodeRuneInString(s)
+	if n == 0 || n != len(s) || r == '"' || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("Invalid delimiter '%s'", s)
+	}
+	return r, nil
+}
+
+// Convert a date format such as "MM/DD/YYYY" or "DD-MMM-YY" to a time
+// layout. M and D without a leading zero also match single digits.
+func csvDateLayout(format string) string {
+	tokens := []struct{ tok, layout string }{
+		{"YYYY", "2006"},
+		{"MMM", "Jan"},
+		{"MM", "01"},
+		{"DD", "02"},
+		{"YY", "06"},
+		{"M", "1"},
+		{"D", "2"},
+	}
+	var sb strings.Builder
+	for len(format) > 0 {
+		matched := false
+		for _, t := range tokens {
+			if strings.HasPrefix(format, t.tok) {
+				sb.WriteString(t.layout)
+				format = format[len(t.tok):]
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			sb.WriteByte(format[0])
+			format = format[1:]
+		}
+	}
+	return sb.String()
+}
+
+// Parse amount written with decimal separator sep ("." or ","). The other
+// character is taken as a thousands separator. Currency symbols and
+// spaces are ignored. A trailing '-' or enclosing parentheses make it
+// negative.
+func parseCSVAmount(s, sep string, cur *Currency) (Money, error) {
+	orig := s
+	var sb strings.Builder
+	for _, c := range s {
+		if (c >= '0' && c <= '9') || c == '.' || c == ',' || c == '-' || c == '+' || c == '(' || c == ')' {
+			sb.WriteRune(c)
+		}
+	}
+	s = sb.String()
+	if strings.HasSuffix(s, "-") {
+		s = "-" + s[:len(s)-1]
+	}
+	if sep == "," {
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.ReplaceAll(s, ",", ".")
+	} else {
+		s = strings.ReplaceAll(s, ",", "")
+	}
+	m, err := parseMoney(s, cur)
+	if err != nil {
+		return Money{}, fmt.Errorf("Invalid amount '%s'", orig)
+	}
+	return m, nil
+}
+
+// Index of column spec (1-based number or heading name) in a row, or -1
+// if spec is blank.
+func csvColumn(spec string, headings []string) (int, error) {
+	if spec == "" {
+		return -1, nil
+	}
+	if n, err := strconv.Atoi(spec); err == nil {
+		if n < 1 {
+			return 0, fmt.Errorf("Invalid column number %d", n)
+		}
+		return n - 1, nil
+	}
+	for i, h := range headings {
+		if strings.EqualFold(strings.TrimSpace(h), strings.TrimSpace(spec)) {
+			return i, nil
+		}
+	}
+	if headings == nil {
+		return 0, fmt.Errorf("Column '%s' is a name but the file has no header row", spec)
+	}
+	return 0, fmt.Errorf("Column '%s' not found in header row", spec)
+}
+
+// Read transactions for an account from a CSV file using mapping m.
+// Rows with a blank date, such as trailing totals, are skipped. A dated
+// row without an amount is an error rather than a zero transaction.
+func readCSVTrans(r io.Reader, m *CSVMapping, cur *Currency) ([]*Trans, error) {
+	err := checkCSVMapping(m)
+	if err != nil {
+		return nil, err
+	}
+	cr := csv.NewReader(r)
+	cr.Comma, _ = csvDelimiter(m.Delimiter)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	for i := 0; i < m.Skip; i++ {
+		_, err := cr.Read()
+		if err == io.EOF {
+			return []*Trans{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	var headings []string
+	if m.Header {
+		headings, err = cr.Read()
+		if err == io.EOF {
+			return []*Trans{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Excel writes a byte order mark at the start of UTF-8 files.
+		if len(headings) > 0 {
+			headings[0] = strings.TrimPrefix(headings[0], "\ufeff")
+		}
+	}
+
+	specs := []string{m.Datecol, m.Refcol, m.Desccol, m.Amtcol, m.Debitcol, m.Creditcol}
+	cols := make([]int, len(specs))
+	for i, spec := range specs {
+		cols[i], err = csvColumn(spec, headings)
+		if err != nil {
+			return nil, err
+		}
+	}
+	datei, refi, desci, amti, debiti, crediti := cols[0], cols[1], cols[2], cols[3], cols[4], cols[5]
+
+	layout := csvDateLayout(m.Dateformat)
+	tt := []*Trans{}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		field := func(i int) string {
+			if i < 0 || i >= len(rec) {
+				return ""
+			}
+			return strings.TrimSpace(rec[i])
+		}
+
+		sdate := field(datei)
+		if sdate == "" {
+			continue
+		}
+		dt, err := time.Parse(layout, sdate)
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: date '%s' doesn't match format '%s'", line, sdate, m.Dateformat)
+		}
+
+		var amt Money
+		if amti >= 0 {
+			if field(amti) == "" {
+				return nil, fmt.Errorf("Line %d: amount is blank", line)
+			}
+			amt, err = parseCSVAmount(field(amti), m.Decimalsep, cur)
+			if err != nil {
+				return nil, fmt.Errorf("Line %d: %s", line, err)
+			}
+		} else {
+			if field(debiti) == "" && field(crediti) == "" {
+				return nil, fmt.Errorf("Line %d: debit and credit are both blank", line)
+			}
+			amt = Money{0, cur}
+			if s := field(crediti); s != "" {
+				credit, err := parseCSVAmount(s, m.Decimalsep, cur)
+				if err != nil {
+					return nil, fmt.Errorf("Line %d: %s", line, err)
+				}
+				amt = amt.Add(credit)
+			}
+			// Debits are money out whether or not the bank shows them
+			// with a minus sign.
+			if s := field(debiti); s != "" {
+				debit, err := parseCSVAmount(s, m.Decimalsep, cur)
+				if err != nil {
+					return nil, fmt.Errorf("Line %d: %s", line, err)
+				}
+				if debit.Units > 0 {
+					debit = debit.Neg()
+				}
+				amt = amt.Add(debit)
+			}
+		}
+
+		tt = append(tt, &Trans{
+			Accountid: m.Accountid,
+			Date:      dt.Format(dateFormat),
+			Ref:       field(refi),
+			Desc:      field(desci),
+			Amt:       amt.Units,
+		})
+	}
+	return tt, nil
+}
+
+// Add transactions from a CSV file to account m.Accountid, all or none.
+// Returns the number added.
+func importCSV(db *sql.DB, m *CSVMapping, r io.Reader) (int, error) {
+	cur, err := findAccountCurrency(db, m.Accountid)
+	if err != nil {
+		return 0, err
+	}
+	tt, err := readCSVTrans(r, m, cur)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	for _, t := range tt {
+		_, err := txcreateTrans(tx, t)
+		if err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return len(tt), nil
+}
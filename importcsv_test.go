@@ -0,0 +1,152 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var testCur = &Currency{Currencyid: 1, Name: "USD", Usdrate: 1, Decimals: 2}
+
+func TestCSVDateLayout(t *testing.T) {
+	tests := []struct {
+		format string
+		date   string
+		want   string
+	}{
+		{"YYYY-MM-DD", "2024-01-31", "2024-01-31"},
+		{"MM/DD/YYYY", "01/31/2024", "2024-01-31"},
+		{"DD/MM/YYYY", "31/01/2024", "2024-01-31"},
+		{"M/D/YYYY", "1/5/2024", "2024-01-05"},
+		{"M/D/YYYY", "12/25/2024", "2024-12-25"},
+		{"DD-MMM-YY", "05-Feb-24", "2024-02-05"},
+		{"DD.MM.YYYY", "05.02.2024", "2024-02-05"},
+		{"YYYYMMDD", "20240205", "2024-02-05"},
+	}
+	for _, tt := range tests {
+		layout := csvDateLayout(tt.format)
+		d, err := time.Parse(layout, tt.date)
+		if err != nil {
+			t.Errorf("%s: parsing '%s' with layout '%s': %s", tt.format, tt.date, layout, err)
+			continue
+		}
+		if got := d.Format(dateFormat); got != tt.want {
+			t.Errorf("%s: '%s' = %s, want %s", tt.format, tt.date, got, tt.want)
+		}
+	}
+}
+
+func TestParseCSVAmount(t *testing.T) {
+	tests := []struct {
+		s, sep string
+		want   int64
+		ok     bool
+	}{
+		{"12.50", ".", 1250, true},
+		{"-1,234.56", ".", -123456, true},
+		{"$1,234.56", ".", 123456, true},
+		{"1.234,56", ",", 123456, true},
+		{"-12,5", ",", -1250, true},
+		{"(45.00)", ".", -4500, true},
+		{"45.00-", ".", -4500, true},
+		{"+7", ".", 700, true},
+		{"EUR 1 234,56", ",", 123456, true},
+		{"0.005", ".", 1, true},
+		{"", ".", 0, false},
+		{"n/a", ".", 0, false},
+		{"1.2.3", ".", 0, false},
+	}
+	for _, tt := range tests {
+		m, err := parseCSVAmount(tt.s, tt.sep, testCur)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseCSVAmount(%q, %q) error = %v, want ok %t", tt.s, tt.sep, err, tt.ok)
+			continue
+		}
+		if tt.ok && m.Units != tt.want {
+			t.Errorf("parseCSVAmount(%q, %q) = %d, want %d", tt.s, tt.sep, m.Units, tt.want)
+		}
+	}
+}
+
+func TestReadCSVTrans(t *testing.T) {
+	type row struct {
+		date, ref, desc string
+		amt             int64
+	}
+	tests := []struct {
+		name    string
+		m       CSVMapping
+		data    string
+		want    []row
+		wanterr string // substring of the error, "" for none
+	}{
+		{"default columns",
+			*defaultCSVMapping(1),
+			"2024-01-02,Coffee,-3.50\n2024-01-03,Salary,1000\n",
+			[]row{{"2024-01-02", "", "Coffee", -350}, {"2024-01-03", "", "Salary", 100000}}, ""},
+		{"header names, byte order mark and skipped lines",
+			CSVMapping{Datecol: "Date", Refcol: "Check", Desccol: "Description", Amtcol: "Amount",
+				Dateformat: "MM/DD/YYYY", Decimalsep: ".", Delimiter: ",", Skip: 2, Header: true},
+			"Bank statement\nAccount 1234\n\ufeffDate,Check,Description,Amount\n01/31/2024,101,\"Rent, January\",\"-1,200.00\"\n",
+			[]row{{"2024-01-31", "101", "Rent, January", -120000}}, ""},
+		{"debit and credit columns",
+			CSVMapping{Datecol: "1", Desccol: "2", Debitcol: "3", Creditcol: "4",
+				Dateformat: "DD.MM.YYYY", Decimalsep: ",", Delimiter: ";"},
+			"05.02.2024;Shop;12,50;\n06.02.2024;Refund;;3,00\n07.02.2024;Fee;-1,00;\n",
+			[]row{{"2024-02-05", "", "Shop", -1250}, {"2024-02-06", "", "Refund", 300}, {"2024-02-07", "", "Fee", -100}}, ""},
+		{"rows without a date are skipped",
+			*defaultCSVMapping(1),
+			"2024-01-02,Coffee,-3.50\n,Total,-3.50\n",
+			[]row{{"2024-01-02", "", "Coffee", -350}}, ""},
+		{"tab delimiter",
+			CSVMapping{Datecol: "1", Desccol: "2", Amtcol: "3", Dateformat: "YYYY-MM-DD", Decimalsep: ".", Delimiter: "tab"},
+			"2024-01-02\tCoffee\t-3.50\n",
+			[]row{{"2024-01-02", "", "Coffee", -350}}, ""},
+		{"blank amount",
+			*defaultCSVMapping(1),
+			"2024-01-02,Coffee,-3.50\n2024-01-03,Pending,\n",
+			nil, "Line 2: amount is blank"},
+		{"blank debit and credit",
+			CSVMapping{Datecol: "1", Desccol: "2", Debitcol: "3", Creditcol: "4",
+				Dateformat: "YYYY-MM-DD", Decimalsep: ".", Delimiter: ","},
+			"2024-01-02,Balance,,\n",
+			nil, "Line 1: debit and credit are both blank"},
+		{"date in the wrong format",
+			*defaultCSVMapping(1),
+			"01/02/2024,Coffee,-3.50\n",
+			nil, "doesn't match format"},
+		{"header name not found",
+			CSVMapping{Datecol: "Posted", Desccol: "2", Amtcol: "3", Dateformat: "YYYY-MM-DD", Decimalsep: ".", Delimiter: ",", Header: true},
+			"Date,Desc,Amt\n",
+			nil, "not found in header row"},
+		{"header name without a header row",
+			CSVMapping{Datecol: "Date", Desccol: "2", Amtcol: "3", Dateformat: "YYYY-MM-DD", Decimalsep: ".", Delimiter: ","},
+			"2024-01-02,Coffee,-3.50\n",
+			nil, "no header row"},
+	}
+	for _, tt := range tests {
+		m := tt.m
+		m.Accountid = 1
+		got, err := readCSVTrans(strings.NewReader(tt.data), &m, testCur)
+		if tt.wanterr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wanterr) {
+				t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.wanterr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d transactions, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for i, w := range tt.want {
+			g := got[i]
+			if g.Accountid != 1 || g.Date != w.date || g.Ref != w.ref || g.Desc != w.desc || g.Amt != w.amt {
+				t.Errorf("%s: row %d = %s %q %q %d, want %s %q %q %d", tt.name, i, g.Date, g.Ref, g.Desc, g.Amt, w.date, w.ref, w.desc, w.amt)
+			}
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+//CREATE TABLE fitid (account_id INTEGER NOT NULL REFERENCES account(account_id) ON DELETE CASCADE, fitid TEXT NOT NULL, trans_id INTEGER REFERENCES trans(trans_id) ON DELETE SET NULL, PRIMARY KEY (account_id, fitid))
+
+// Transaction from the STMTTRN aggregate of an OFX statement. Fields are
+// as they appear in the file.
+type OFXTrans struct {
+	Fitid    string // id unique within the account, used to skip re-imports
+	Posted   string // DTPOSTED, ex. "20240131" or "20240131120000.000[-5:EST]"
+	Amt      string // TRNAMT
+	Checknum string
+	Name     string
+	Memo     string
+	Acctid   string // ACCTID of the statement's BANKACCTFROM or CCACCTFROM
+}
+
+// Parse the transactions out of an OFX or QFX file. Both the SGML based
+// version 1.x, whose leaf elements have no end tags, and the XML based
+// version 2.x are read by treating the text after a start tag up to the
+// next tag as its value. Each transaction gets the account id of the bank
+// or credit card statement it's in.
+func parseOFX(r io.Reader) ([]*OFXTrans, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	// 1.x files are often in Windows-1252. Read non UTF-8 files as that.
+	var s string
+	if utf8.Valid(data) {
+		s = string(data)
+	} else {
+		s = decodeCP1252(data)
+	}
+
+	start := strings.Index(strings.ToUpper(s), "<OFX>")
+	if start < 0 {
+		return nil, fmt.Errorf("Not an OFX file, no <OFX> element")
+	}
+	s = s[start:]
+
+	tt := []*OFXTrans{}
+	var cur *OFXTrans
+	leaf := ""
+	acctid := ""
+	infrom := false
+	for len(s) > 0 {
+		lt := strings.IndexByte(s, '<')
+		if lt < 0 {
+			break
+		}
+		if leaf == "ACCTID" && infrom {
+			acctid = strings.TrimSpace(s[:lt])
+		} else if leaf != "" && cur != nil {
+			cur.set(leaf, html.UnescapeString(strings.TrimSpace(s[:lt])))
+		}
+		leaf = ""
+		s = s[lt:]
+		if strings.HasPrefix(s, "<!--") {
+			end := strings.Index(s, "-->")
+			if end < 0 {
+				break
+			}
+			s = s[end+3:]
+			continue
+		}
+		gt := strings.IndexByte(s, '>')
+		if gt < 0 {
+			return nil, fmt.Errorf("Unterminated tag '%.20s'", s)
+		}
+		tag := strings.ToUpper(strings.TrimSpace(s[1:gt]))
+		s = s[gt+1:]
+
+		switch {
+		case strings.HasPrefix(tag, "?"), strings.HasPrefix(tag, "!"), strings.HasSuffix(tag, "/"):
+		case tag == "/STMTTRN":
+			if cur != nil {
+				tt = append(tt, cur)
+				cur = nil
+			}
+		case tag == "STMTRS", tag == "CCSTMTRS":
+			acctid = ""
+		case tag == "BANKACCTFROM", tag == "CCACCTFROM":
+			infrom = true
+		case tag == "/BANKACCTFROM", tag == "/CCACCTFROM":
+			infrom = false
+		case strings.HasPrefix(tag, "/"):
+		case tag == "STMTTRN":
+			cur = &OFXTrans{Acctid: acctid}
+		default:
+			leaf = tag
+		}
+	}
+	return tt, nil
+}
+
+// Windows-1252 characters for bytes 0x80 to 0x9F. The rest of the bytes
+// are the same as in Latin-1. The five bytes it leaves undefined are kept
+// as the Latin-1 control characters.
+var cp1252 = [32]rune{
+	'\u20ac', '\u0081', '\u201a', '\u0192', '\u201e', '\u2026', '\u2020', '\u2021',
+	'\u02c6', '\u2030', '\u0160', '\u2039', '\u0152', '\u008d', '\u017d', '\u008f',
+	'\u0090', '\u2018', '\u2019', '\u201c', '\u201d', '\u2022', '\u2013', '\u2014',
+	'\u02dc', '\u2122', '\u0161', '\u203a', '\u0153', '\u009d', '\u017e', '\u0178',
+}
+
+// Decode Windows-1252 text.
+func decodeCP1252(data []byte) string {
+	rr := make([]rune, len(data))
+	for i, b := range data {
+		if b >= 0x80 && b <= 0x9f {
+			rr[i] = cp1252[b-0x80]
+		} else {
+			rr[i] = rune(b)
+		}
+	}
+	return string(rr)
+}
+
+func (t *OFXTrans) set(tag, val string) {
+	switch tag {
+	case "FITID":
+		t.Fitid = val
+	case "DTPOSTED":
+		t.Posted = val
+	case "TRNAMT":
+		t.Amt = val
+	case "CHECKNUM":
+		t.Checknum = val
+	case "NAME":
+		t.Name = val
+	case "MEMO":
+		t.Memo = val
+	}
+}
+
+// Convert to a transaction of account accountid. The description is the
+// payee name followed by the memo, or whichever of them there is.
+func (t *OFXTrans) Trans(accountid int64, cur *Currency) (*Trans, error) {
+	if len(t.Posted) < 8 || !isDate(t.Posted[:4]+"-"+t.Posted[4:6]+"-"+t.Posted[6:8]) {
+		return nil, fmt.Errorf("Transaction %s: invalid date '%s'", t.Fitid, t.Posted)
+	}
+	// Some banks write the amount with a decimal comma.
+	samt := t.Amt
+	if !strings.Contains(samt, ".") {
+		samt = strings.Replace(samt, ",", ".", 1)
+	}
+	amt, err := parseMoney(samt, cur)
+	if err != nil {
+		return nil, fmt.Errorf("Transaction %s: invalid amount '%s'", t.Fitid, t.Amt)
+	}
+
+	desc := t.Name
+	if desc == "" {
+		desc = t.Memo
+	} else if t.Memo != "" && t.Memo != t.Name {
+		desc = t.Name + " - " + t.Memo
+	}
+	return &Trans{
+		Accountid: accountid,
+		Date:      t.Posted[:4] + "-" + t.Posted[4:6] + "-" + t.Posted[6:8],
+		Ref:       t.Checknum,
+		Desc:      desc,
+		Amt:       amt.Units,
+	}, nil
+}
+
+// Add the transactions of an OFX or QFX file to an account, all or none.
+// Transactions whose FITID was imported into the account before are
+// skipped, even if they were deleted since. Returns the numbers added and
+// skipped.
+//
+// A file with statements of several accounts needs acctid, the ACCTID of
+// the statement to import. If acctid isn't blank only that statement is
+// imported.
+func importOFX(db *sql.DB, accountid int64, r io.Reader, acctid string) (int, int, error) {
+	oo, err := parseOFX(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	oo, err = ofxStatementTrans(oo, acctid)
+	if err != nil {
+		return 0, 0, err
+	}
+	cur, err := findAccountCurrency(db, accountid)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	added, skipped, err := tximportOFX(tx, accountid, cur, oo)
+	if err != nil {
+		tx.Rollback()
+		return 0, 0, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, 0, err
+	}
+	return added, skipped, nil
+}
+func tximportOFX(tx *sql.Tx, accountid int64, cur *Currency, oo []*OFXTrans) (int, int, error) {
+	var added, skipped int
+	for _, o := range oo {
+		if o.Fitid != "" {
+			var n int
+			s := "SELECT COUNT(*) FROM fitid WHERE account_id = ? AND fitid = ?"
+			err := tx.QueryRow(s, accountid, o.Fitid).Scan(&n)
+			if err != nil {
+				return 0, 0, err
+			}
+			if n > 0 {
+				skipped++
+				continue
+			}
+		}
+
+		t, err := o.Trans(accountid, cur)
+		if err != nil {
+			return 0, 0, err
+		}
+		transid, err := txcreateTrans(tx, t)
+		if err != nil {
+			return 0, 0, err
+		}
+		if o.Fitid != "" {
+			s := "INSERT INTO fitid (account_id, fitid, trans_id) VALUES (?, ?, ?)"
+			_, err := txexec(tx, s, accountid, o.Fitid, transid)
+			if err != nil {
+				return 0, 0, err
+			}
+		}
+		added++
+	}
+	return added, skipped, nil
+}
+
+// Transactions of the statement of account acctid. Blank acctid returns
+// all of them, as long as they're all from one account's statement.
+func ofxStatementTrans(oo []*OFXTrans, acctid string) ([]*OFXTrans, error) {
+	var ids []string
+	for _, o := range oo {
+		if !listContains(ids, o.Acctid) {
+			ids = append(ids, o.Acctid)
+		}
+	}
+	if acctid == "" {
+		if len(ids) > 1 {
+			return nil, fmt.Errorf("File has statements of several accounts (%s), pick one by its account id", strings.Join(ids, ", "))
+		}
+		return oo, nil
+	}
+
+	matched := []*OFXTrans{}
+	for _, o := range oo {
+		if o.Acctid == acctid {
+			matched = append(matched, o)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("File has no statement of account id '%s', only of (%s)", acctid, strings.Join(ids, ", "))
+	}
+	return matched, nil
+}
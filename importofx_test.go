@@ -0,0 +1,255 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// New db file with the starting data, removed when the test ends.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dbfile := filepath.Join(t.TempDir(), "test.db")
+	err := createTables(dbfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := openDB(dbfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+const ofxSGML = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+ENCODING:USASCII
+
+<OFX>
+<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0<SEVERITY>INFO</STATUS></SONRS></SIGNONMSGSRSV1>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>USD
+<BANKACCTFROM><BANKID>121000248<ACCTID>1234567<ACCTTYPE>CHECKING</BANKACCTFROM>
+<BANKTRANLIST>
+<DTSTART>20240101
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20240105120000.000[-5:EST]
+<TRNAMT>-42.10
+<FITID>A1
+<CHECKNUM>1001
+<NAME>HARDWARE STORE
+<MEMO>Paint &amp; brushes
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20240106
+<TRNAMT>1500,00
+<FITID>A2
+<NAME>PAYROLL
+<BANKACCTTO><BANKID>121000248<ACCTID>7654321<ACCTTYPE>SAVINGS</BANKACCTTO>
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+const ofxXML = `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE"?>
+<OFX>
+  <BANKMSGSRSV1><STMTTRNRS><STMTRS><BANKTRANLIST>
+    <!-- <STMTTRN><FITID>X</FITID></STMTTRN> -->
+    <STMTTRN>
+      <TRNTYPE>DEBIT</TRNTYPE>
+      <DTPOSTED>20240207</DTPOSTED>
+      <TRNAMT>-5.00</TRNAMT>
+      <FITID>B1</FITID>
+      <NAME>Café</NAME>
+      <MEMO>Café</MEMO>
+      <EXTDNAME/>
+    </STMTTRN>
+    <STMTTRN>
+      <DTPOSTED>20240208</DTPOSTED>
+      <TRNAMT>-1.25</TRNAMT>
+      <FITID>B2</FITID>
+      <MEMO>Bank fee</MEMO>
+    </STMTTRN>
+  </BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+const ofxTwoStatements = `<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<BANKACCTFROM><ACCTID>111</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><TRNAMT>-1.00<FITID>E1</STMTTRN>
+<STMTTRN><TRNAMT>-2.00<FITID>E2</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+<CREDITCARDMSGSRSV1><CCSTMTTRNRS><CCSTMTRS>
+<CCACCTFROM><ACCTID>4111XXXX1111</CCACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><TRNAMT>-3.00<FITID>F1</STMTTRN>
+</BANKTRANLIST>
+</CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1>
+</OFX>
+`
+
+func TestParseOFX(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []OFXTrans
+		wanterr bool
+	}{
+		{"SGML without end tags", ofxSGML, []OFXTrans{
+			{Fitid: "A1", Posted: "20240105120000.000[-5:EST]", Amt: "-42.10", Checknum: "1001", Name: "HARDWARE STORE", Memo: "Paint & brushes", Acctid: "1234567"},
+			{Fitid: "A2", Posted: "20240106", Amt: "1500,00", Name: "PAYROLL", Acctid: "1234567"},
+		}, false},
+		{"XML with a comment", ofxXML, []OFXTrans{
+			{Fitid: "B1", Posted: "20240207", Amt: "-5.00", Name: "Café", Memo: "Café"},
+			{Fitid: "B2", Posted: "20240208", Amt: "-1.25", Memo: "Bank fee"},
+		}, false},
+		{"Windows-1252", "<OFX><STMTTRN><FITID>C1<NAME>Caf\xe9 \x93Le Bon\x94 \x80 5\x85</STMTTRN></OFX>", []OFXTrans{
+			{Fitid: "C1", Name: "Café “Le Bon” € 5…"},
+		}, false},
+		{"bank and credit card statements", ofxTwoStatements, []OFXTrans{
+			{Fitid: "E1", Amt: "-1.00", Acctid: "111"},
+			{Fitid: "E2", Amt: "-2.00", Acctid: "111"},
+			{Fitid: "F1", Amt: "-3.00", Acctid: "4111XXXX1111"},
+		}, false},
+		{"no statement transactions", "<OFX><SIGNONMSGSRSV1></SIGNONMSGSRSV1></OFX>", nil, false},
+		{"not OFX", "Date,Amount\n2024-01-01,5\n", nil, true},
+		{"unterminated tag", "<OFX><STMTTRN><FITID", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := parseOFX(strings.NewReader(tt.data))
+		if (err != nil) != tt.wanterr {
+			t.Errorf("%s: error = %v, want error %t", tt.name, err, tt.wanterr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d transactions, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for i, w := range tt.want {
+			if *got[i] != w {
+				t.Errorf("%s: transaction %d = %+v, want %+v", tt.name, i, *got[i], w)
+			}
+		}
+	}
+}
+
+func TestOFXStatementTrans(t *testing.T) {
+	oo, err := parseOFX(strings.NewReader(ofxTwoStatements))
+	if err != nil {
+		t.Fatal(err)
+	}
+	single, err := parseOFX(strings.NewReader(ofxSGML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		oo      []*OFXTrans
+		acctid  string
+		want    []string // FITIDs
+		wanterr bool
+	}{
+		{"one statement", single, "", []string{"A1", "A2"}, false},
+		{"one statement, its account id", single, "1234567", []string{"A1", "A2"}, false},
+		{"one statement, another account id", single, "7654321", nil, true},
+		{"two statements, no account id", oo, "", nil, true},
+		{"two statements, bank", oo, "111", []string{"E1", "E2"}, false},
+		{"two statements, credit card", oo, "4111XXXX1111", []string{"F1"}, false},
+		{"two statements, unknown account id", oo, "222", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ofxStatementTrans(tt.oo, tt.acctid)
+		if (err != nil) != tt.wanterr {
+			t.Errorf("%s: error = %v, want error %t", tt.name, err, tt.wanterr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d transactions, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for i, fitid := range tt.want {
+			if got[i].Fitid != fitid {
+				t.Errorf("%s: transaction %d FITID = %s, want %s", tt.name, i, got[i].Fitid, fitid)
+			}
+		}
+	}
+}
+
+func TestOFXTrans(t *testing.T) {
+	tests := []struct {
+		o       OFXTrans
+		date    string
+		desc    string
+		amt     int64
+		wanterr bool
+	}{
+		{OFXTrans{Fitid: "1", Posted: "20240105120000.000[-5:EST]", Amt: "-42.10", Name: "STORE", Memo: "Paint"}, "2024-01-05", "STORE - Paint", -4210, false},
+		{OFXTrans{Fitid: "2", Posted: "20240106", Amt: "1500,00", Name: "PAYROLL", Memo: "PAYROLL"}, "2024-01-06", "PAYROLL", 150000, false},
+		{OFXTrans{Fitid: "3", Posted: "20240107", Amt: "1,500.00", Memo: "Fee"}, "2024-01-07", "Fee", 150000, false},
+		{OFXTrans{Fitid: "4", Posted: "202401", Amt: "1.00"}, "", "", 0, true},
+		{OFXTrans{Fitid: "5", Posted: "20240231", Amt: "1.00"}, "", "", 0, true},
+		{OFXTrans{Fitid: "6", Posted: "20240107", Amt: ""}, "", "", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := tt.o.Trans(3, testCur)
+		if (err != nil) != tt.wanterr {
+			t.Errorf("FITID %s: error = %v, want error %t", tt.o.Fitid, err, tt.wanterr)
+			continue
+		}
+		if tt.wanterr {
+			continue
+		}
+		if got.Accountid != 3 || got.Date != tt.date || got.Desc != tt.desc || got.Amt != tt.amt {
+			t.Errorf("FITID %s: got %s %q %d, want %s %q %d", tt.o.Fitid, got.Date, got.Desc, got.Amt, tt.date, tt.desc, tt.amt)
+		}
+	}
+}
+
+func TestImportOFXDuplicateFitids(t *testing.T) {
+	db := openTestDB(t)
+	const accountid = 3 // bpiusd
+	before, err := findTransByAccount(db, accountid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same FITID twice in one file, then the whole file again.
+	data := "<OFX>" +
+		"<STMTTRN><DTPOSTED>20240105<TRNAMT>-1.00<FITID>D1<NAME>One</STMTTRN>" +
+		"<STMTTRN><DTPOSTED>20240105<TRNAMT>-1.00<FITID>D1<NAME>One again</STMTTRN>" +
+		"<STMTTRN><DTPOSTED>20240106<TRNAMT>-2.00<FITID>D2<NAME>Two</STMTTRN>" +
+		"<STMTTRN><DTPOSTED>20240107<TRNAMT>-3.00<NAME>No FITID</STMTTRN>" +
+		"</OFX>"
+	tests := []struct {
+		added, skipped int
+	}{
+		{3, 1},
+		{1, 3}, // only the one without a FITID can't be recognized
+	}
+	for i, tt := range tests {
+		added, skipped, err := importOFX(db, accountid, strings.NewReader(data), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if added != tt.added || skipped != tt.skipped {
+			t.Errorf("import %d: added %d, skipped %d, want %d and %d", i+1, added, skipped, tt.added, tt.skipped)
+		}
+	}
+	after, err := findTransByAccount(db, accountid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(after) - len(before); n != 4 {
+		t.Errorf("got %d new transactions, want 4", n)
+	}
+}
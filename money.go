@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Amount of money in a currency. The amount is kept as an integer number of
+// minor units (ex. cents for Decimals=2) so that sums are exact.
+// Cur may be nil for amounts whose currency isn't known, in which case two
+// decimals are assumed.
+type Money struct {
+	Units int64
+	Cur   *Currency
+}
+
+// How to round amounts that have more decimals than the currency allows.
+type RoundingMode int
+
+const (
+	RoundHalfUp   RoundingMode = iota // 0.005 -> 0.01, -0.005 -> -0.01
+	RoundHalfEven                     // 0.005 -> 0.00, 0.015 -> 0.02 (banker's rounding)
+	RoundDown                         // toward zero
+)
+
+func (m Money) decimals() int {
+	if m.Cur == nil {
+		return 2
+	}
+	return m.Cur.Decimals
+}
+
+func sameCurrency(m, n Money) bool {
+	if m.Cur == nil || n.Cur == nil {
+		return m.Cur == n.Cur
+	}
+	return m.Cur.Currencyid == n.Cur.Currencyid
+}
+
+// Adding amounts of different currencies is a programming error, they need
+// to be converted first.
+func (m Money) Add(n Money) Money {
+	if !sameCurrency(m, n) {
+		panic(fmt.Sprintf("Money.Add() currency mismatch: %s and %s", m.CurName(), n.CurName()))
+	}
+	return Money{m.Units + n.Units, m.Cur}
+}
+func (m Money) Sub(n Money) Money {
+	return m.Add(n.Neg())
+}
+func (m Money) Neg() Money {
+	return Money{-m.Units, m.Cur}
+}
+func (m Money) IsZero() bool {
+	return m.Units == 0
+}
+func (m Money) Sign() int {
+	switch {
+	case m.Units < 0:
+		return -1
+	case m.Units > 0:
+		return 1
+	}
+	return 0
+}
+
+func (m Money) CurName() string {
+	if m.Cur == nil {
+		return ""
+	}
+	return m.Cur.Name
+}
+
+// Amount in major units as an exact rational, ex. 1234.56
+func (m Money) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(m.Units), pow10(m.decimals()))
+}
+
+// Approximate amount in major units, for display scaling only (ex. charts).
+func (m Money) Float64() float64 {
+	f, _ := m.Rat().Float64()
+	return f
+}
+
+// Multiply amount by r, rounding the result to the currency's decimals.
+func (m Money) Mul(r *big.Rat, mode RoundingMode) Money {
+	units := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Units), r)
+	return Money{roundRat(units, mode), m.Cur}
+}
+
+// Return money in currency cur for amount r in major units.
+func moneyFromRat(r *big.Rat, cur *Currency, mode RoundingMode) Money {
+	m := Money{0, cur}
+	units := new(big.Rat).Mul(r, new(big.Rat).SetInt(pow10(m.decimals())))
+	m.Units = roundRat(units, mode)
+	return m
+}
+
+// Parse amount such as "1,234.56", "-12.5" or "(12.50)" in currency cur.
+// Extra decimals beyond what the currency allows are rounded half up.
+func parseMoney(s string, cur *Currency) (Money, error) {
+	s = strings.TrimSpace(s)
+	neg := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		neg = true
+		s = s[1 : len(s)-1]
+	}
+	s = strings.ReplaceAll(s, ",", "")
+	if s == "" {
+		return Money{}, fmt.Errorf("invalid amount '%s'", s)
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9') && c != '.' && c != '-' && c != '+' {
+			return Money{}, fmt.Errorf("invalid amount '%s'", s)
+		}
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Money{}, fmt.Errorf("invalid amount '%s'", s)
+	}
+	if neg {
+		r.Neg(r)
+	}
+	return moneyFromRat(r, cur, RoundHalfUp), nil
+}
+
+// Format amount with thousands separators, ex. "-1,234.56".
+func (m Money) String() string {
+	dec := m.decimals()
+	units := m.Units
+	neg := units < 0
+	if neg {
+		units = -units
+	}
+	s := fmt.Sprintf("%0*d", dec+1, units)
+	sint, sfrac := s[:len(s)-dec], s[len(s)-dec:]
+
+	var sb strings.Builder
+	if neg {
+		sb.WriteString("-")
+	}
+	for i, c := range sint {
+		if i > 0 && (len(sint)-i)%3 == 0 {
+			sb.WriteString(",")
+		}
+		sb.WriteRune(c)
+	}
+	if dec > 0 {
+		sb.WriteString(".")
+		sb.WriteString(sfrac)
+	}
+	return sb.String()
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// Round r to an integer.
+func roundRat(r *big.Rat, mode RoundingMode) int64 {
+	num := r.Num()
+	den := r.Denom()
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() == 0 || mode == RoundDown {
+		return q.Int64()
+	}
+
+	// Compare 2*|rem| against den to see which side of half we're on.
+	twice := new(big.Int).Abs(rem)
+	twice.Lsh(twice, 1)
+	cmp := twice.Cmp(den)
+	away := cmp > 0
+	if cmp == 0 {
+		switch mode {
+		case RoundHalfUp:
+			away = true
+		case RoundHalfEven:
+			away = q.Bit(0) == 1
+		}
+	}
+	if away {
+		if num.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q.Int64()
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Record of a QIF file: the fields between '^' lines, keyed by their one
+// letter code, under the !Type header it appeared in, ex. "Bank" or
+// "Invst". Only the first of a repeated code is kept, so only the first
+// line of a split (S, E and $) is.
+//
+// Account is the name of the account whose section the record is in, for
+// files exported with several accounts. It's blank if there's none.
+type QIFRecord struct {
+	Type    string
+	Account string
+	Fields  map[byte]string
+}
+
+// Parse the records of a QIF file. In a multi-account file each account's
+// records follow an !Account header with the account's name. The account
+// list between !Option:AutoSwitch and !Clear:AutoSwitch doesn't change the
+// current account.
+func parseQIF(r io.Reader) ([]*QIFRecord, error) {
+	rr := []*QIFRecord{}
+	typ := ""
+	account := ""
+	autoswitch := false
+	cur := &QIFRecord{Fields: map[byte]string{}}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		line = strings.TrimPrefix(line, "\ufeff")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "!Type:"):
+			typ = strings.TrimSpace(line[len("!Type:"):])
+		case strings.HasPrefix(line, "!Account"):
+			typ = "Account"
+		case strings.HasPrefix(line, "!Option:AutoSwitch"):
+			autoswitch = true
+		case strings.HasPrefix(line, "!Clear:AutoSwitch"):
+			autoswitch = false
+		case strings.HasPrefix(line, "!"):
+			// Other options don't start a new section.
+		case line[0] == '^':
+			if len(cur.Fields) > 0 {
+				rr = append(rr, cur)
+				if cur.Type == "Account" && !autoswitch {
+					account = cur.Fields['N']
+				}
+			}
+			cur = &QIFRecord{Fields: map[byte]string{}}
+		default:
+			cur.Type = typ
+			cur.Account = account
+			if _, ok := cur.Fields[line[0]]; !ok {
+				cur.Fields[line[0]] = strings.TrimSpace(line[1:])
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(cur.Fields) > 0 {
+		rr = append(rr, cur)
+	}
+	return rr, nil
+}
+
+// Whether QIF type typ holds bank style transactions.
+func isQIFBankType(typ string) bool {
+	switch strings.ToLower(typ) {
+	case "bank", "cash", "ccard", "oth a", "oth l":
+		return true
+	}
+	return false
+}
+
+// Parse a QIF date such as "1/31/2024", "1/31'24" or "1/31/24", month
+// first unless dmy. An apostrophe before a two digit year means 20xx,
+// otherwise two digit years from 50 on are 19xx.
+func parseQIFDate(s string, dmy bool) (string, error) {
+	s = strings.TrimSpace(s)
+	apos := strings.Contains(s, "'")
+	parts := strings.FieldsFunc(s, func(c rune) bool {
+		return c == '/' || c == '-' || c == '.' || c == '\'' || c == ' '
+	})
+	if len(parts) != 3 {
+		return "", fmt.Errorf("Invalid date '%s'", s)
+	}
+	nn := make([]int, 3)
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return "", fmt.Errorf("Invalid date '%s'", s)
+		}
+		nn[i] = n
+	}
+	m, d, y := nn[0], nn[1], nn[2]
+	if dmy {
+		m, d = d, m
+	}
+	if len(parts[2]) <= 2 {
+		if apos || y < 50 {
+			y += 2000
+		} else {
+			y += 1900
+		}
+	}
+	dt := fmt.Sprintf("%04d-%02d-%02d", y, m, d)
+	if !isDate(dt) {
+		return "", fmt.Errorf("Invalid date '%s'", s)
+	}
+	return dt, nil
+}
+
+// Format date as MM/DD/YYYY, or DD/MM/YYYY if dmy.
+func formatQIFDate(dt string, dmy bool) string {
+	if len(dt) != len(dateFormat) {
+		return dt
+	}
+	if dmy {
+		return dt[8:10] + "/" + dt[5:7] + "/" + dt[0:4]
+	}
+	return dt[5:7] + "/" + dt[8:10] + "/" + dt[0:4]
+}
+
+// Amount without thousands separators, ex. "-1234.56".
+func qifAmt(m Money) string {
+	return strings.ReplaceAll(m.String(), ",", "")
+}
+
+// Cleared status: '*' or 'c' is cleared, 'X' or 'R' reconciled. Reconciled
+// transactions come in as cleared since there's no statement for them.
+func parseQIFStatus(s string) TransStatus {
+	if s == "" {
+		return StatusUncleared
+	}
+	return StatusCleared
+}
+
+// Add the transactions of a QIF file to an account, all or none. !Type:Bank
+// style records become ordinary transactions with their payee and category,
+// created if needed. !Type:Invst records become trades and cash entries of
+// the account, which must be one whose type tracks shares. Records of other
+// types (category lists, memorized transactions) and investment actions
+// with no equivalent, such as stock splits, are skipped. Returns the
+// numbers added and skipped.
+//
+// From a file with several accounts, only the records of the one named the
+// same as the account (by name or code) are imported.
+func importQIF(db *sql.DB, accountid int64, r io.Reader, dmy bool) (int, int, error) {
+	rr, err := parseQIF(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	a, err := findAccount(db, accountid)
+	if err != nil {
+		return 0, 0, err
+	}
+	if a == nil {
+		return 0, 0, fmt.Errorf("Account %d doesn't exist", accountid)
+	}
+	at, err := findAccountType(db, a.Accounttypeid)
+	if err != nil {
+		return 0, 0, err
+	}
+	cur, err := findAccountCurrency(db, accountid)
+	if err != nil {
+		return 0, 0, err
+	}
+	rr, err = qifAccountRecords(rr, a)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	var added, skipped int
+	for i, rec := range rr {
+		var t *Trans
+		switch {
+		case isQIFBankType(rec.Type):
+			t, err = txqifBankTrans(tx, rec, cur, dmy)
+		case strings.EqualFold(rec.Type, "Invst"):
+			if at == nil || !at.Isshares {
+				tx.Rollback()
+				return 0, 0, fmt.Errorf("Investment records can only be imported into an account whose type tracks shares")
+			}
+			t, err = qifInvstTrans(rec, cur, dmy)
+		}
+		if err != nil {
+			tx.Rollback()
+			return 0, 0, fmt.Errorf("Record %d: %s", i+1, err)
+		}
+		if t == nil {
+			skipped++
+			continue
+		}
+		t.Accountid = accountid
+		_, err = txcreateTrans(tx, t)
+		if err != nil {
+			tx.Rollback()
+			return 0, 0, err
+		}
+		added++
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, 0, err
+	}
+	return added, skipped, nil
+}
+
+// Transaction records of account a, without the !Account header records.
+// If the file has records of more than one account, those of the account
+// named a.Name or a.Code are returned, otherwise all of them.
+func qifAccountRecords(rr []*QIFRecord, a *Account) ([]*QIFRecord, error) {
+	recs := []*QIFRecord{}
+	var names []string
+	for _, rec := range rr {
+		if rec.Type == "Account" {
+			continue
+		}
+		recs = append(recs, rec)
+		if !listContains(names, rec.Account) {
+			names = append(names, rec.Account)
+		}
+	}
+	if len(names) <= 1 {
+		return recs, nil
+	}
+
+	matched := []*QIFRecord{}
+	for _, rec := range recs {
+		if strings.EqualFold(rec.Account, a.Name) || strings.EqualFold(rec.Account, a.Code) {
+			matched = append(matched, rec)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("File has several accounts (%s) and none is named '%s' or '%s'", strings.Join(names, ", "), a.Name, a.Code)
+	}
+	return matched, nil
+}
+
+// Bank record: D date, T amount, N check number, P payee, M memo,
+// L category, C cleared. The description is the memo, or the payee if
+// there's no memo. A category in brackets, ex. "[Savings]", names the other
+// account of a transfer and is left out. Split transactions (with S lines,
+// L usually "--Splits--") are left uncategorized since a transaction has
+// only one category.
+func txqifBankTrans(tx *sql.Tx, rec *QIFRecord, cur *Currency, dmy bool) (*Trans, error) {
+	f := rec.Fields
+	dt, err := parseQIFDate(f['D'], dmy)
+	if err != nil {
+		return nil, err
+	}
+	samt := f['T']
+	if samt == "" {
+		samt = f['U']
+	}
+	amt, err := parseCSVAmount(samt, ".", cur)
+	if err != nil {
+		return nil, err
+	}
+	t := Trans{
+		Date:   dt,
+		Ref:    f['N'],
+		Desc:   f['M'],
+		Amt:    amt.Units,
+		Status: parseQIFStatus(f['C']),
+	}
+	if t.Desc == "" {
+		t.Desc = f['P']
+	}
+	if f['P'] != "" {
+		t.Payeeid, err = txcreatePayeeName(tx, f['P'])
+		if err != nil {
+			return nil, err
+		}
+	}
+	_, split := f['S']
+	if l := f['L']; l != "" && !split && !strings.HasPrefix(l, "[") && !strings.HasPrefix(l, "--") {
+		// Classes follow the category after a '/'.
+		if i := strings.Index(l, "/"); i >= 0 {
+			l = l[:i]
+		}
+		if l != "" {
+			t.Categoryid, err = txcreateCategoryPath(tx, l)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &t, nil
+}
+
+// Investment record: D date, N action, Y security, I price, Q shares,
+// T total amount, P and M description, C cleared. Returns nil for actions
+// that aren't imported.
+//
+// Buys (including reinvestments and shares transferred in) have positive
+// Qty and Amt, sells negative. Income and cash moved in are positive Amt
+// with no shares, expenses and cash moved out negative.
+func qifInvstTrans(rec *QIFRecord, cur *Currency, dmy bool) (*Trans, error) {
+	f := rec.Fields
+	dt, err := parseQIFDate(f['D'], dmy)
+	if err != nil {
+		return nil, err
+	}
+	t := Trans{
+		Date:   dt,
+		Desc:   f['M'],
+		Symbol: f['Y'],
+		Status: parseQIFStatus(f['C']),
+	}
+	if t.Desc == "" {
+		t.Desc = f['P']
+	}
+
+	var amt Money
+	samt := f['T']
+	if samt == "" {
+		samt = f['U']
+	}
+	if samt != "" {
+		amt, err = parseCSVAmount(samt, ".", cur)
+		if err != nil {
+			return nil, err
+		}
+	}
+	parseShares := func() error {
+		if s := f['Q']; s != "" {
+			t.Qty, err = parseFixed(s)
+			if err != nil {
+				return err
+			}
+		}
+		if s := f['I']; s != "" {
+			t.Price, err = parseFixed(s)
+			if err != nil {
+				return err
+			}
+		}
+		if t.Qty < 0 {
+			t.Qty = -t.Qty
+		}
+		return nil
+	}
+	abs := amt.Units
+	if abs < 0 {
+		abs = -abs
+	}
+
+	action := strings.ToLower(f['N'])
+	switch action {
+	case "buy", "buyx", "shrsin", "reinvdiv", "reinvint", "reinvlg", "reinvmd", "reinvsh":
+		err := parseShares()
+		if err != nil {
+			return nil, err
+		}
+		t.Amt = abs
+	case "sell", "sellx", "shrsout":
+		err := parseShares()
+		if err != nil {
+			return nil, err
+		}
+		t.Qty = -t.Qty
+		t.Amt = -abs
+	case "div", "divx", "intinc", "intincx", "cglong", "cglongx", "cgmid", "cgmidx", "cgshort", "cgshortx",
+		"miscinc", "miscincx", "rtrncap", "rtrncapx", "xin", "contribx":
+		t.Amt = abs
+	case "miscexp", "miscexpx", "margint", "margintx", "xout", "withdrwx":
+		t.Amt = -abs
+	case "cash":
+		t.Amt = amt.Units
+	default:
+		return nil, nil
+	}
+	return &t, nil
+}
+
+// Write an account's transactions as QIF. Accounts whose type tracks shares
+// are written as !Type:Invst, others as !Type:Bank.
+func exportQIF(w io.Writer, db *sql.DB, accountid int64, dmy bool) error {
+	a, err := findAccount(db, accountid)
+	if err != nil {
+		return err
+	}
+	if a == nil {
+		return fmt.Errorf("Account %d doesn't exist", accountid)
+	}
+	at, err := findAccountType(db, a.Accounttypeid)
+	if err != nil {
+		return err
+	}
+	cur, err := findAccountCurrency(db, accountid)
+	if err != nil {
+		return err
+	}
+	cc, err := findCategories(db)
+	if err != nil {
+		return err
+	}
+	paths := map[int64]string{}
+	for _, c := range cc {
+		paths[c.Categoryid] = c.Path
+	}
+	tt, err := findTransByDate(db, accountid, "", "")
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	if at != nil && at.Isshares {
+		fmt.Fprintln(bw, "!Type:Invst")
+	} else {
+		fmt.Fprintln(bw, "!Type:Bank")
+	}
+	for _, t := range tt {
+		fmt.Fprintf(bw, "D%s\n", formatQIFDate(t.Date, dmy))
+		if at != nil && at.Isshares {
+			writeQIFInvst(bw, t, cur)
+		} else {
+			err := writeQIFBank(bw, db, t, cur, paths)
+			if err != nil {
+				return err
+			}
+		}
+		switch t.Status {
+		case StatusCleared:
+			fmt.Fprintln(bw, "C*")
+		case StatusReconciled:
+			fmt.Fprintln(bw, "CX")
+		}
+		fmt.Fprintln(bw, "^")
+	}
+	return bw.Flush()
+}
+
+// Payee and memo lines. The payee is the description if the transaction
+// has no payee.
+func writeQIFPayee(w io.Writer, db *sql.DB, t *Trans) error {
+	payee := t.Desc
+	if t.Payeeid != 0 {
+		p, err := findPayee(db, t.Payeeid)
+		if err != nil {
+			return err
+		}
+		if p != nil {
+			payee = p.Name
+		}
+	}
+	if payee != "" {
+		fmt.Fprintf(w, "P%s\n", payee)
+	}
+	if t.Desc != "" && t.Desc != payee {
+		fmt.Fprintf(w, "M%s\n", t.Desc)
+	}
+	return nil
+}
+
+// Transfer legs get the other account's name in brackets as category.
+func writeQIFBank(w io.Writer, db *sql.DB, t *Trans, cur *Currency, paths map[int64]string) error {
+	fmt.Fprintf(w, "T%s\n", qifAmt(Money{t.Amt, cur}))
+	if t.Ref != "" {
+		fmt.Fprintf(w, "N%s\n", t.Ref)
+	}
+	err := writeQIFPayee(w, db, t)
+	if err != nil {
+		return err
+	}
+	x, err := findTransferByTrans(db, t.Transid)
+	if err != nil {
+		return err
+	}
+	if x != nil {
+		otherid := x.Toaccountid
+		if otherid == t.Accountid {
+			otherid = x.Fromaccountid
+		}
+		other, err := findAccount(db, otherid)
+		if err != nil {
+			return err
+		}
+		if other != nil {
+			fmt.Fprintf(w, "L[%s]\n", other.Name)
+		}
+	} else if path, ok := paths[t.Categoryid]; ok {
+		fmt.Fprintf(w, "L%s\n", path)
+	}
+	return nil
+}
+
+// Trades are written as Buy or Sell. Entries without shares are Div (or
+// MiscExp) when they have a symbol, otherwise XIn or XOut.
+func writeQIFInvst(w io.Writer, t *Trans, cur *Currency) {
+	amt := Money{t.Amt, cur}
+	if t.Qty != 0 {
+		amt = tradeAmt(t, cur)
+	}
+	if amt.Units < 0 {
+		amt = amt.Neg()
+	}
+	qty := t.Qty
+	action := "Buy"
+	switch {
+	case t.Qty < 0:
+		action = "Sell"
+		qty = -qty
+	case t.Qty == 0 && t.Symbol != "" && t.Amt >= 0:
+		action = "Div"
+	case t.Qty == 0 && t.Symbol != "":
+		action = "MiscExp"
+	case t.Qty == 0 && t.Amt >= 0:
+		action = "XIn"
+	case t.Qty == 0:
+		action = "XOut"
+	}
+	fmt.Fprintf(w, "N%s\n", action)
+	if t.Symbol != "" {
+		fmt.Fprintf(w, "Y%s\n", t.Symbol)
+	}
+	if t.Qty != 0 {
+		fmt.Fprintf(w, "I%s\n", t.Price)
+		fmt.Fprintf(w, "Q%s\n", qty)
+	}
+	fmt.Fprintf(w, "T%s\n", qifAmt(amt))
+	if t.Desc != "" {
+		fmt.Fprintf(w, "M%s\n", t.Desc)
+	}
+}
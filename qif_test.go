@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseQIFDate(t *testing.T) {
+	tests := []struct {
+		s       string
+		dmy     bool
+		want    string
+		wanterr bool
+	}{
+		{"1/31/2024", false, "2024-01-31", false},
+		{"01/31/2024", false, "2024-01-31", false},
+		{" 1/31/2024 ", false, "2024-01-31", false},
+		{"1/31'24", false, "2024-01-31", false},
+		{"1/31' 4", false, "2004-01-31", false},
+		{"12/31'99", false, "2099-12-31", false},
+		{"1/31/24", false, "2024-01-31", false},
+		{"1/31/49", false, "2049-01-31", false},
+		{"1/31/99", false, "1999-01-31", false},
+		{"1-31-2024", false, "2024-01-31", false},
+		{"31/1/2024", true, "2024-01-31", false},
+		{"31.01.2024", true, "2024-01-31", false},
+		{"5/2'24", true, "2024-02-05", false},
+		{"31/1/2024", false, "", true},
+		{"2/30/2024", false, "", true},
+		{"1/31", false, "", true},
+		{"Jan 31 2024", false, "", true},
+		{"", false, "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseQIFDate(tt.s, tt.dmy)
+		if (err != nil) != tt.wanterr {
+			t.Errorf("parseQIFDate(%q, %t) error = %v, want error %t", tt.s, tt.dmy, err, tt.wanterr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseQIFDate(%q, %t) = %q, want %q", tt.s, tt.dmy, got, tt.want)
+		}
+	}
+}
+
+func TestQIFInvstTrans(t *testing.T) {
+	tests := []struct {
+		action string
+		amt    string // T
+		qty    string // Q
+		wantq  Fixed
+		wanta  int64
+		isnil  bool
+	}{
+		{"Buy", "1000.00", "10", 10000000, 100000, false},
+		{"BuyX", "-1000.00", "10", 10000000, 100000, false},
+		{"ReinvDiv", "25.00", "0.5", 500000, 2500, false},
+		{"ShrsIn", "", "3", 3000000, 0, false},
+		{"Sell", "1200.00", "10", -10000000, -120000, false},
+		{"SellX", "1200.00", "-10", -10000000, -120000, false},
+		{"ShrsOut", "", "3", -3000000, 0, false},
+		{"Div", "-15.00", "", 0, 1500, false},
+		{"IntInc", "2.50", "", 0, 250, false},
+		{"CGLong", "40.00", "", 0, 4000, false},
+		{"XIn", "500.00", "", 0, 50000, false},
+		{"MiscExp", "4.95", "", 0, -495, false},
+		{"XOut", "500.00", "", 0, -50000, false},
+		{"WithdrwX", "-500.00", "", 0, -50000, false},
+		{"Cash", "-12.00", "", 0, -1200, false},
+		{"Cash", "12.00", "", 0, 1200, false},
+		{"StkSplit", "", "2", 0, 0, true},
+		{"Reminder", "", "", 0, 0, true},
+	}
+	for _, tt := range tests {
+		rec := &QIFRecord{Type: "Invst", Fields: map[byte]string{
+			'D': "1/31/2024", 'N': tt.action, 'Y': "ACME", 'I': "100",
+		}}
+		if tt.amt != "" {
+			rec.Fields['T'] = tt.amt
+		}
+		if tt.qty != "" {
+			rec.Fields['Q'] = tt.qty
+		}
+		got, err := qifInvstTrans(rec, testCur, false)
+		if err != nil {
+			t.Errorf("%s: %s", tt.action, err)
+			continue
+		}
+		if tt.isnil {
+			if got != nil {
+				t.Errorf("%s: got a transaction, want none", tt.action)
+			}
+			continue
+		}
+		if got == nil {
+			t.Errorf("%s: got no transaction", tt.action)
+			continue
+		}
+		if got.Qty != tt.wantq || got.Amt != tt.wanta || got.Date != "2024-01-31" || got.Symbol != "ACME" {
+			t.Errorf("%s: got qty %d amt %d %s %s, want qty %d amt %d", tt.action, got.Qty, got.Amt, got.Date, got.Symbol, tt.wantq, tt.wanta)
+		}
+	}
+}
+
+const qifMultiAccount = `!Option:AutoSwitch
+!Account
+NChecking
+TBank
+^
+NSavings
+TBank
+^
+!Clear:AutoSwitch
+!Account
+NChecking
+TBank
+^
+!Type:Bank
+D1/5/2024
+T-20.00
+PGrocer
+^
+!Account
+NSavings
+TBank
+^
+!Type:Bank
+D1/6/2024
+T100.00
+PInterest
+^
+D1/7/2024
+T5.00
+PInterest
+^
+`
+
+func TestQIFAccountRecords(t *testing.T) {
+	rr, err := parseQIF(strings.NewReader(qifMultiAccount))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		a       Account
+		want    []string // payee of each record
+		wanterr bool
+	}{
+		{Account{Code: "chk", Name: "Checking"}, []string{"Grocer"}, false},
+		{Account{Code: "savings", Name: "BPI Savings"}, []string{"Interest", "Interest"}, false},
+		{Account{Code: "usd", Name: "Dollars"}, nil, true},
+	}
+	for _, tt := range tests {
+		got, err := qifAccountRecords(rr, &tt.a)
+		if (err != nil) != tt.wanterr {
+			t.Errorf("%s: error = %v, want error %t", tt.a.Code, err, tt.wanterr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d records, want %d", tt.a.Code, len(got), len(tt.want))
+			continue
+		}
+		for i, p := range tt.want {
+			if got[i].Fields['P'] != p {
+				t.Errorf("%s: record %d payee = %q, want %q", tt.a.Code, i, got[i].Fields['P'], p)
+			}
+		}
+	}
+
+	// A file of one account, with or without an !Account header, is
+	// imported whatever the account is named. The header isn't returned.
+	single := "!Type:Bank\nD1/5/2024\nT-20.00\n^\nD1/6/2024\nT-5.00\n^\n"
+	for _, data := range []string{single, "!Account\nNChecking\nTBank\n^\n" + single} {
+		rr, err = parseQIF(strings.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := qifAccountRecords(rr, &Account{Code: "usd", Name: "Dollars"})
+		if err != nil || len(got) != 2 {
+			t.Errorf("single account %q: got %d records, error %v, want 2", data[:8], len(got), err)
+		}
+	}
+}
+
+// Export a bank account and a share account, import each file into a new
+// account of the same type and compare the transactions.
+func TestQIFRoundTrip(t *testing.T) {
+	db := openTestDB(t)
+	catid, err := createCategoryPath(db, "Food:Groceries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grocer, err := createPayeeName(db, "Grocer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	employer, err := createPayeeName(db, "Employer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		typeid int64 // 1 Bank, 2 Stock
+		tt     []Trans
+	}{
+		{"bank", 1, []Trans{
+			{Date: "2024-01-05", Ref: "101", Desc: "Weekly shop", Amt: -4550, Categoryid: catid, Payeeid: grocer, Status: StatusCleared},
+			{Date: "2024-01-15", Desc: "Employer", Amt: 250000, Payeeid: employer},
+			{Date: "2024-01-20", Ref: "102", Desc: "Corner store", Amt: -1234, Categoryid: catid, Payeeid: grocer},
+		}},
+		{"shares", 2, []Trans{
+			{Date: "2024-02-01", Desc: "Deposit", Amt: 200000},
+			{Date: "2024-02-02", Desc: "Buy ACME", Symbol: "ACME", Qty: 10000000, Price: 100000000, Amt: 100500, Status: StatusCleared},
+			{Date: "2024-03-01", Desc: "Dividend", Symbol: "ACME", Amt: 1500},
+			{Date: "2024-03-02", Desc: "Fee", Symbol: "ACME", Amt: -495},
+			{Date: "2024-04-01", Desc: "Sell ACME", Symbol: "ACME", Qty: -4000000, Price: 120500000, Amt: -47700},
+			{Date: "2024-04-02", Desc: "Withdrawal", Amt: -20000},
+		}},
+	}
+	for _, tt := range tests {
+		src, err := createAccount(db, &Account{Code: tt.name + "-src", Name: tt.name + " source", Accounttypeid: tt.typeid, Currencyid: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst, err := createAccount(db, &Account{Code: tt.name + "-dst", Name: tt.name + " copy", Accounttypeid: tt.typeid, Currencyid: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range tt.tt {
+			tt.tt[i].Accountid = src
+			_, err := createTrans(db, &tt.tt[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var buf bytes.Buffer
+		err = exportQIF(&buf, db, src, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		added, skipped, err := importQIF(db, dst, bytes.NewReader(buf.Bytes()), false)
+		if err != nil {
+			t.Fatalf("%s: %s\n%s", tt.name, err, buf.String())
+		}
+		if added != len(tt.tt) || skipped != 0 {
+			t.Errorf("%s: added %d, skipped %d, want %d and 0", tt.name, added, skipped, len(tt.tt))
+		}
+
+		got, err := findTransByDate(db, dst, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != len(tt.tt) {
+			t.Errorf("%s: got %d transactions, want %d\n%s", tt.name, len(got), len(tt.tt), buf.String())
+			continue
+		}
+		for i, w := range tt.tt {
+			g := *got[i]
+			w.Transid, w.Accountid, w.Journalid = g.Transid, dst, g.Journalid
+			if g != w {
+				t.Errorf("%s: transaction %d = %+v, want %+v", tt.name, i, g, w)
+			}
+		}
+	}
+}
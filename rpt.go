@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Describe date range for report titles, ex. "2024-01-01 to 2024-03-31".
+func periodText(startdt, enddt string) string {
+	switch {
+	case startdt != "" && enddt != "":
+		return fmt.Sprintf("%s to %s", startdt, enddt)
+	case startdt != "":
+		return "from " + startdt
+	case enddt != "":
+		return "to " + enddt
+	}
+	return "all dates"
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Print totals by category from startdt to enddt in currency repcur.
+// Subcategories are indented under their parent, whose total includes
+// theirs.
+func printCategoryReport(w io.Writer, db *sql.DB, repcur *Currency, startdt, enddt string) error {
+	ctt, err := findCategoryTotals(db, repcur, startdt, enddt)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Totals by Category (%s), %s\n\n", repcur.Name, periodText(startdt, enddt))
+	fmt.Fprintf(w, "%-40s %14s\n", "Category", "Amount")
+	tot := Money{0, repcur}
+	for _, ct := range ctt {
+		fmt.Fprintf(w, "%-40s %14s\n", categoryLabel(ct.Category), ct.Amt)
+		if ct.Category.Parentid == 0 {
+			tot = tot.Add(ct.Amt)
+		}
+	}
+	fmt.Fprintf(w, "%-40s %14s\n", "Total", tot)
+	return nil
+}
+
+// Category name indented two spaces per level.
+func categoryLabel(c *Category) string {
+	return strings.Repeat("  ", c.Depth()) + c.Name
+}
+
+// Print totals by payee from startdt to enddt in currency repcur.
+func printPayeeReport(w io.Writer, db *sql.DB, repcur *Currency, startdt, enddt string) error {
+	ptt, err := findPayeeTotals(db, repcur, startdt, enddt)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Totals by Payee (%s), %s\n\n", repcur.Name, periodText(startdt, enddt))
+	fmt.Fprintf(w, "%-40s %14s\n", "Payee", "Amount")
+	tot := Money{0, repcur}
+	for _, pt := range ptt {
+		fmt.Fprintf(w, "%-40s %14s\n", pt.Payee.Name, pt.Amt)
+		tot = tot.Add(pt.Amt)
+	}
+	fmt.Fprintf(w, "%-40s %14s\n", "Total", tot)
+	return nil
+}
+
+// Print totals by tag from startdt to enddt in currency repcur. There's no
+// grand total since a transaction can have more than one tag.
+func printTagReport(w io.Writer, db *sql.DB, repcur *Currency, startdt, enddt string) error {
+	gtt, err := findTagTotals(db, repcur, startdt, enddt)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Totals by Tag (%s), %s\n\n", repcur.Name, periodText(startdt, enddt))
+	fmt.Fprintf(w, "%-40s %14s\n", "Tag", "Amount")
+	for _, gt := range gtt {
+		fmt.Fprintf(w, "%-40s %14s\n", gt.Tag.Name, gt.Amt)
+	}
+	return nil
+}
+
+// Print transactions tagged name from startdt to enddt with their total in
+// currency repcur.
+func printTaggedReport(w io.Writer, db *sql.DB, repcur *Currency, name, startdt, enddt string) error {
+	tt, err := findTransByTag(db, name, startdt, enddt)
+	if err != nil {
+		return err
+	}
+	cv, err := newConverter(db)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Tagged '%s' (%s), %s\n\n", name, repcur.Name, periodText(startdt, enddt))
+	fmt.Fprintf(w, "%-10s  %-20s %-30s %14s\n", "Date", "Account", "Description", "Amount")
+	tot := Money{0, repcur}
+	for _, t := range tt {
+		a, err := findAccount(db, t.Accountid)
+		if err != nil {
+			return err
+		}
+		cur, err := findAccountCurrency(db, t.Accountid)
+		if err != nil {
+			return err
+		}
+		amt := Money{t.Amt, cur}
+		fmt.Fprintf(w, "%-10s  %-20.20s %-30.30s %14s %s\n", t.Date, a.Name, t.Desc, amt, cur.Name)
+		camt, err := cv.ConvertAsOf(amt, repcur, t.Date)
+		if err != nil {
+			return err
+		}
+		tot = tot.Add(camt)
+	}
+	fmt.Fprintf(w, "%-10s  %-20s %-30s %14s %s\n", "Total", "", "", tot, repcur.Name)
+	return nil
+}
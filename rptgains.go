@@ -0,0 +1,49 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+)
+
+// Print realized gains of sells from startdt to enddt and the unrealized
+// gains of current holdings of a stock account.
+func printGainsReport(w io.Writer, db *sql.DB, a *Account, startdt, enddt string) error {
+	cur, err := findAccountCurrency(db, a.Accountid)
+	if err != nil {
+		return err
+	}
+	gains, err := findRealizedGains(db, a.Accountid, startdt, enddt)
+	if err != nil {
+		return err
+	}
+	hh, err := findHoldingsAsOf(db, a.Accountid, enddt)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Gains - %s (%s, %s), %s\n\n", a.Name, cur.Name, a.Costmethod, periodText(startdt, enddt))
+
+	fmt.Fprintf(w, "Realized\n")
+	fmt.Fprintf(w, "%-10s  %-10s %14s %14s %14s %14s\n", "Date", "Symbol", "Shares", "Proceeds", "Cost", "Gain")
+	totProceeds, totCost, totGain := Money{0, cur}, Money{0, cur}, Money{0, cur}
+	for _, g := range gains {
+		fmt.Fprintf(w, "%-10s  %-10s %14s %14s %14s %14s\n", g.Date, g.Symbol, g.Qty, g.Proceeds, g.Cost, g.Gain)
+		totProceeds = totProceeds.Add(g.Proceeds)
+		totCost = totCost.Add(g.Cost)
+		totGain = totGain.Add(g.Gain)
+	}
+	fmt.Fprintf(w, "%-10s  %-10s %14s %14s %14s %14s\n\n", "Total", "", "", totProceeds, totCost, totGain)
+
+	fmt.Fprintf(w, "Unrealized\n")
+	fmt.Fprintf(w, "%-10s  %14s %12s %14s %14s %14s\n", "Symbol", "Shares", "Price", "Value", "Cost", "Gain")
+	totValue, totCost, totGain := Money{0, cur}, Money{0, cur}, Money{0, cur}
+	for _, h := range hh {
+		fmt.Fprintf(w, "%-10s  %14s %12s %14s %14s %14s\n", h.Symbol, h.Qty, h.Price, h.Value, h.Cost, h.Gain)
+		totValue = totValue.Add(h.Value)
+		totCost = totCost.Add(h.Cost)
+		totGain = totGain.Add(h.Gain)
+	}
+	fmt.Fprintf(w, "%-10s  %14s %12s %14s %14s %14s\n", "Total", "", "", totValue, totCost, totGain)
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Print income and expenses from startdt to enddt per month, quarter or
+// year in currency repcur, by category or by account.
+func printIncomeReport(w io.Writer, db *sql.DB, repcur *Currency, startdt, enddt string, unit PeriodUnit, byaccount bool) error {
+	rpt, err := findIncomeReport(db, repcur, startdt, enddt, unit, byaccount)
+	if err != nil {
+		return err
+	}
+	by := "Category"
+	if byaccount {
+		by = "Account"
+	}
+	fmt.Fprintf(w, "Income and Expenses by %s (%s), %s\n\n", by, repcur.Name, periodText(startdt, enddt))
+
+	fmt.Fprintf(w, "%-30s", by)
+	for _, p := range rpt.Periods {
+		fmt.Fprintf(w, " %13s", p.Label)
+	}
+	fmt.Fprintf(w, " %14s\n", "Total")
+
+	printRow := func(r *IncomeRow) {
+		fmt.Fprintf(w, "%-30.30s", incomeLabel(r))
+		for _, m := range r.Amts {
+			fmt.Fprintf(w, " %13s", m)
+		}
+		fmt.Fprintf(w, " %14s\n", r.Total)
+	}
+	for _, sect := range []*IncomeSection{rpt.Income, rpt.Expenses} {
+		fmt.Fprintf(w, "\n%s\n", sect.Name)
+		for _, r := range sect.Rows {
+			printRow(r)
+		}
+		printRow(sect.Subtotal)
+	}
+	fmt.Fprintln(w)
+	printRow(rpt.Net)
+	return nil
+}
+
+// Row label indented two spaces per subcategory level.
+func incomeLabel(r *IncomeRow) string {
+	return strings.Repeat("  ", r.Depth) + r.Label
+}
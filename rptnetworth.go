@@ -0,0 +1,72 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Print net worth at the end of each month from startdt to enddt in
+// currency repcur, followed by a bar chart of it.
+func printNetWorthReport(w io.Writer, db *sql.DB, repcur *Currency, startdt, enddt string) error {
+	nn, err := findNetWorth(db, repcur, startdt, enddt)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Net Worth (%s), %s\n\n", repcur.Name, periodText(startdt, enddt))
+	fmt.Fprintf(w, "%-10s %16s %16s\n", "Month", "Net Worth", "Change")
+	incomplete := false
+	for _, nw := range nn {
+		mark := ""
+		if !nw.Complete {
+			mark = " *"
+			incomplete = true
+		}
+		fmt.Fprintf(w, "%-10s %16s %16s%s\n", nw.Period.Label, nw.Amt, nw.Change, mark)
+	}
+	if incomplete {
+		fmt.Fprintf(w, "* Leaves out balances that couldn't be converted to %s.\n", repcur.Name)
+	}
+
+	fmt.Fprintln(w)
+	for _, line := range netWorthChart(nn, 50) {
+		fmt.Fprintln(w, line)
+	}
+	return nil
+}
+
+// Horizontal bar chart of net worth, one bar per month, scaled to fit
+// width characters. Negative amounts extend left of the zero axis.
+func netWorthChart(nn []*NetWorth, width int) []string {
+	var lo, hi float64
+	for _, nw := range nn {
+		v := nw.Amt.Float64()
+		if v < lo {
+			lo = v
+		}
+		if v > hi {
+			hi = v
+		}
+	}
+	if hi == lo {
+		hi = lo + 1
+	}
+	scale := float64(width) / (hi - lo)
+	negw := int(-lo*scale + 0.5)
+
+	lines := []string{}
+	for _, nw := range nn {
+		v := nw.Amt.Float64()
+		n := int(v*scale + 0.5)
+		var bar string
+		if v < 0 {
+			n = int(-v*scale + 0.5)
+			bar = strings.Repeat(" ", negw-n) + strings.Repeat("#", n) + "|"
+		} else {
+			bar = strings.Repeat(" ", negw) + "|" + strings.Repeat("#", n)
+		}
+		lines = append(lines, fmt.Sprintf("%-10s %s", nw.Period.Label, bar))
+	}
+	return lines
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -37,12 +38,11 @@ func run(args []string) error {
 		if fileExists(dbfile) {
 			return fmt.Errorf("File '%s' already exists. Can't initialize it.\n", dbfile)
 		}
-		createTables(dbfile)
-		return nil
+		return createTables(dbfile)
 	}
 
 	// Need to specify a db file as first parameter.
-	if len(parms) == 0 {
+	if len(parms) == 0 || (commands[parms[0]] != nil && len(parms) < 2) {
 		s := `Usage:
 
    Specify database file:
@@ -51,23 +51,94 @@ func run(args []string) error {
    To initialize new database file:
 	t -i <new db file>
 
+   Commands:
+	t gains <db file> <account code> [-from <date>] [-to <date>]
+		Print realized and unrealized gains of a stock account
+	t convert <db file>
+		Convert single-entry transactions to double-entry
+	t categories <db file> [-from <date>] [-to <date>]
+		Print totals by category
+	t payees <db file> [-from <date>] [-to <date>]
+		Print totals by payee
+	t tags <db file> [tag] [-from <date>] [-to <date>]
+		Print totals by tag, or the transactions with a tag
+	t due <db file> [-to <date>] [--post]
+		List scheduled transactions due by date (default today),
+		--post to enter them
+	t schedules <db file> [account code]
+		List scheduled transactions with their ids
+	t sched-add <db file> <account code> -date <start> -amt <amount> [schedule options]
+	t sched-edit <db file> <schedule id> [schedule options]
+		Add or change a scheduled transaction
+		-date <date>        First occurrence
+		-every <n>d|w|m     Repeat every n days, weeks or months (default 1m)
+		-to <date>          Last date, or none (default no end)
+		-count <n>          Number of occurrences, 0 for no limit
+		-amt <amount> -desc <desc> -ref <ref>
+		-cat <category>     ex. Food:Groceries
+		-payee <payee>
+		--lastbizday, --nolastbizday  Monthly on the last weekday
+	t sched-del <db file> <schedule id>
+		Delete a scheduled transaction
+	t income <db file> [-from <date>] [-to <date>] [-per month|quarter|year] [-by category|account]
+		Print income and expenses per period (default from the start
+		of the year to today, by month and category)
+	t networth <db file> [-from <date>] [-to <date>]
+		Print net worth at the end of each month with a chart
+		(default the last 12 months)
+	t import-csv <db file> <account code> <csv file> [mapping options] [--save]
+		Add transactions from a bank CSV export, using the account's
+		saved mapping if it has one. --save saves the mapping given.
+		-date <col> -ref <col> -desc <col>
+		-amt <col> | -debit <col> -credit <col>
+			Columns by number (from 1) or header name
+		-datefmt <format>   ex. MM/DD/YYYY, DD-MMM-YY (default YYYY-MM-DD)
+		-decimal <. or ,>   Decimal separator (default .)
+		-delim <char>       Field separator, or tab (default ,)
+		-skip <n>           Lines to skip before the data or header
+		--header, --noheader  Whether there's a header row
+	t import-ofx <db file> <account code> <ofx or qfx file> [-acctid <id>]
+		Add transactions from an OFX or QFX statement, skipping
+		ones imported before. -acctid picks the statement of a
+		file with several accounts.
+	t import-qif <db file> <account code> <qif file> [--dmy]
+		Add transactions from a QIF file (!Type:Bank or !Type:Invst)
+	t export-qif <db file> <account code> [qif file] [--dmy]
+		Write an account's transactions as QIF (default to stdout)
+		--dmy: dates are day first, DD/MM/YYYY
+
+   Options:
+	-c <currency>   Reporting currency for totals (default USD)
+	-d <date>       Show balances as of date (YYYY-MM-DD), or press 'd'
+
+   Keys:
+	c               Totals by category
+	p               Totals by payee
+	b               Monthly budget by category
+	i               Income and expenses
+	Enter           Account register, then 'r' to reconcile it or 'u' to
+	                set a reconciled transaction back to cleared
+
 `
-		fmt.Printf(s)
+		fmt.Print(s)
 		return nil
 	}
 
-	// Exit if db file doesn't exist.
-	dbfile := parms[0]
-	if !fileExists(dbfile) {
-		return fmt.Errorf(`Database file '%s' doesn't exist. Create one using:
-	t -i <filename>
-   `, dbfile)
+	// t <command> <db file> [args...]
+	if cmd := commands[parms[0]]; cmd != nil {
+		db, err := openDBFile(parms[1])
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		return cmd(db, sw, parms[2:])
 	}
 
-	db, err := sql.Open("sqlite3", dbfile)
+	db, err := openDBFile(parms[0])
 	if err != nil {
-		return fmt.Errorf("Error opening '%s' (%s)\n", dbfile, err)
+		return err
 	}
+	defer db.Close()
 
 	// Start termbox mode
 	err = tb.Init()
@@ -79,9 +150,33 @@ func run(args []string) error {
 
 	_termW, _termH = tb.Size()
 
+	repcur, err := findReportCurrency(db, sw["c"])
+	if err != nil {
+		return err
+	}
+
+	if sw["d"] != "" && !isDate(sw["d"]) {
+		return fmt.Errorf("Invalid date '%s', use YYYY-MM-DD.\n", sw["d"])
+	}
+
 	r := TxRect{0, 0, 80, 25}
-	waccounts := NewWAccounts(db, r, TxColorBWTerm, nil)
-	waccounts.Draw()
+	waccounts := NewWAccounts(db, repcur, r, TxColorBWTerm, nil)
+	if sw["d"] != "" {
+		waccounts.SetAsOf(sw["d"])
+	}
+
+	// List scheduled transactions that are due before showing accounts.
+	var wdue *WDue
+	wdue = NewWDue(db, r, TxColorBWTerm, func(we *TxEvent) {
+		wdue = nil
+		waccounts.SetAsOf(waccounts.asof)
+	})
+	if wdue.Len() > 0 {
+		wdue.Draw()
+	} else {
+		wdue = nil
+		waccounts.Draw()
+	}
 
 	//r := TxRect{5, 5, 40, 1}
 	//entry := NewTxLabelEntry(r, TxMargin0, TxColorGreen, TxColorWhite, nil, "Enter Name", "", "[A-Z]+", 0)
@@ -99,6 +194,17 @@ func run(args []string) error {
 		if e.Ch == 'q' {
 			break
 		}
+		if wdue != nil {
+			if wdue.HandleEvent(e) {
+				if wdue != nil {
+					wdue.Draw()
+				} else {
+					waccounts.Draw()
+				}
+				tb.Flush()
+			}
+			continue
+		}
 		if waccounts.HandleEvent(e) {
 			waccounts.Draw()
 			tb.Flush()
@@ -107,6 +213,528 @@ func run(args []string) error {
 	return nil
 }
 
+type commandFunc func(db *sql.DB, sw map[string]string, args []string) error
+
+// Commands that run without starting the UI.
+var commands = map[string]commandFunc{
+	"gains":      cmdGains,
+	"convert":    cmdConvert,
+	"categories": cmdCategories,
+	"payees":     cmdPayees,
+	"tags":       cmdTags,
+	"due":        cmdDue,
+	"schedules":  cmdSchedules,
+	"sched-add":  cmdSchedAdd,
+	"sched-edit": cmdSchedEdit,
+	"sched-del":  cmdSchedDel,
+	"income":     cmdIncome,
+	"networth":   cmdNetWorth,
+	"import-csv": cmdImportCSV,
+	"import-ofx": cmdImportOFX,
+	"import-qif": cmdImportQIF,
+	"export-qif": cmdExportQIF,
+}
+
+// Open existing db file.
+func openDBFile(dbfile string) (*sql.DB, error) {
+	if !fileExists(dbfile) {
+		return nil, fmt.Errorf(`Database file '%s' doesn't exist. Create one using:
+	t -i <filename>
+   `, dbfile)
+	}
+
+	db, err := openDB(dbfile)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening '%s' (%s)\n", dbfile, err)
+	}
+	return db, nil
+}
+
+// Return account with code, or error if there's none.
+func findAccountArg(db *sql.DB, code string) (*Account, error) {
+	a, err := findAccountByCode(db, code)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return nil, fmt.Errorf("Account '%s' doesn't exist.\n", code)
+	}
+	return a, nil
+}
+
+// t gains <db file> <account code> [-from <date>] [-to <date>]
+func cmdGains(db *sql.DB, sw map[string]string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("Specify account code.\n")
+	}
+	a, err := findAccountArg(db, args[0])
+	if err != nil {
+		return err
+	}
+	return printGainsReport(os.Stdout, db, a, sw["from"], sw["to"])
+}
+
+// t convert <db file>
+func cmdConvert(db *sql.DB, sw map[string]string, args []string) error {
+	n, err := convertSingleEntry(db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Converted %d transaction(s) to double-entry.\n", n)
+	return nil
+}
+
+// t categories <db file> [-from <date>] [-to <date>]
+func cmdCategories(db *sql.DB, sw map[string]string, args []string) error {
+	repcur, err := findReportCurrency(db, sw["c"])
+	if err != nil {
+		return err
+	}
+	return printCategoryReport(os.Stdout, db, repcur, sw["from"], sw["to"])
+}
+
+// t payees <db file> [-from <date>] [-to <date>]
+func cmdPayees(db *sql.DB, sw map[string]string, args []string) error {
+	repcur, err := findReportCurrency(db, sw["c"])
+	if err != nil {
+		return err
+	}
+	return printPayeeReport(os.Stdout, db, repcur, sw["from"], sw["to"])
+}
+
+// t tags <db file> [tag] [-from <date>] [-to <date>]
+func cmdTags(db *sql.DB, sw map[string]string, args []string) error {
+	repcur, err := findReportCurrency(db, sw["c"])
+	if err != nil {
+		return err
+	}
+	if len(args) > 0 {
+		return printTaggedReport(os.Stdout, db, repcur, args[0], sw["from"], sw["to"])
+	}
+	return printTagReport(os.Stdout, db, repcur, sw["from"], sw["to"])
+}
+
+// t due <db file> [-to <date>] [--post]
+func cmdDue(db *sql.DB, sw map[string]string, args []string) error {
+	asof := sw["to"]
+	if asof == "" {
+		asof = today()
+	}
+	if !isDate(asof) {
+		return fmt.Errorf("Invalid date '%s', use YYYY-MM-DD.\n", asof)
+	}
+	dd, err := findDue(db, asof)
+	if err != nil {
+		return err
+	}
+	for _, d := range dd {
+		a, err := findAccount(db, d.Schedule.Accountid)
+		if err != nil {
+			return err
+		}
+		cur, err := findAccountCurrency(db, d.Schedule.Accountid)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%-10s  %-20.20s %-30.30s %14s\n", d.Date, a.Name, d.Schedule.Desc, Money{d.Schedule.Amt, cur})
+	}
+	if sw["post"] == "" {
+		fmt.Printf("%d transaction(s) due.\n", len(dd))
+		return nil
+	}
+	n, err := postDue(db, asof)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Posted %d transaction(s).\n", n)
+	return nil
+}
+
+// t schedules <db file> [account code]
+func cmdSchedules(db *sql.DB, sw map[string]string, args []string) error {
+	var accountid int64
+	if len(args) > 0 {
+		a, err := findAccountArg(db, args[0])
+		if err != nil {
+			return err
+		}
+		accountid = a.Accountid
+	}
+	ss, err := findSchedules(db, accountid)
+	if err != nil {
+		return err
+	}
+	for _, s := range ss {
+		a, err := findAccount(db, s.Accountid)
+		if err != nil {
+			return err
+		}
+		cur, err := findAccountCurrency(db, s.Accountid)
+		if err != nil {
+			return err
+		}
+		every := fmt.Sprintf("every %d %s", s.Every, s.Unit)
+		if s.Lastbizday {
+			every += ", last weekday"
+		}
+		next := s.Next()
+		if next == "" {
+			next = "ended"
+		}
+		fmt.Printf("%4d  %-10s  %-20.20s %-30.30s %14s  %s, next %s\n", s.Scheduleid, s.Startdate, a.Name, s.Desc, Money{s.Amt, cur}, every, next)
+	}
+	fmt.Printf("%d schedule(s).\n", len(ss))
+	return nil
+}
+
+// t sched-add <db file> <account code> -date <start> -amt <amount> [schedule options]
+func cmdSchedAdd(db *sql.DB, sw map[string]string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("Specify account code.\n")
+	}
+	a, err := findAccountArg(db, args[0])
+	if err != nil {
+		return err
+	}
+	if sw["date"] == "" || sw["amt"] == "" {
+		return fmt.Errorf("Specify -date and -amt.\n")
+	}
+	s := Schedule{Accountid: a.Accountid, Every: 1, Unit: UnitMonths}
+	err = scheduleArgs(db, &s, sw)
+	if err != nil {
+		return err
+	}
+	id, err := createSchedule(db, &s)
+	if err != nil {
+		return fmt.Errorf("%s.\n", err)
+	}
+	fmt.Printf("Added schedule %d, next on %s.\n", id, s.Next())
+	return nil
+}
+
+// t sched-edit <db file> <schedule id> [schedule options]
+func cmdSchedEdit(db *sql.DB, sw map[string]string, args []string) error {
+	s, err := findScheduleArg(db, args)
+	if err != nil {
+		return err
+	}
+	err = scheduleArgs(db, s, sw)
+	if err != nil {
+		return err
+	}
+	err = editSchedule(db, s)
+	if err != nil {
+		return fmt.Errorf("%s.\n", err)
+	}
+	next := s.Next()
+	if next == "" {
+		next = "none, the schedule has ended"
+	}
+	fmt.Printf("Updated schedule %d, next on %s.\n", s.Scheduleid, next)
+	return nil
+}
+
+// t sched-del <db file> <schedule id>
+func cmdSchedDel(db *sql.DB, sw map[string]string, args []string) error {
+	s, err := findScheduleArg(db, args)
+	if err != nil {
+		return err
+	}
+	err = delSchedule(db, s.Scheduleid)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deleted schedule %d.\n", s.Scheduleid)
+	return nil
+}
+
+// Return schedule with the id in args[0], or error if there's none.
+func findScheduleArg(db *sql.DB, args []string) (*Schedule, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("Specify schedule id.\n")
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid schedule id '%s'.\n", args[0])
+	}
+	s, err := findSchedule(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, fmt.Errorf("Schedule %d doesn't exist.\n", id)
+	}
+	return s, nil
+}
+
+// Set the schedule fields given in switches, leaving the others as is.
+func scheduleArgs(db *sql.DB, s *Schedule, sw map[string]string) error {
+	if sw["date"] != "" {
+		s.Startdate = sw["date"]
+	}
+	switch sw["to"] {
+	case "":
+	case "none":
+		s.Enddate = ""
+	default:
+		s.Enddate = sw["to"]
+	}
+	if sw["amt"] != "" {
+		cur, err := findAccountCurrency(db, s.Accountid)
+		if err != nil {
+			return err
+		}
+		amt, err := parseMoney(sw["amt"], cur)
+		if err != nil {
+			return fmt.Errorf("Invalid -amt '%s'.\n", sw["amt"])
+		}
+		s.Amt = amt.Units
+	}
+	if sw["desc"] != "" {
+		s.Desc = sw["desc"]
+	}
+	if sw["ref"] != "" {
+		s.Ref = sw["ref"]
+	}
+	if v := sw["every"]; v != "" {
+		units := map[byte]ScheduleUnit{'d': UnitDays, 'w': UnitWeeks, 'm': UnitMonths}
+		unit, ok := units[v[len(v)-1]]
+		n, err := strconv.Atoi(v[:len(v)-1])
+		if !ok || err != nil {
+			return fmt.Errorf("Invalid -every '%s', use ex. 14d, 2w or 1m.\n", v)
+		}
+		s.Every, s.Unit = n, unit
+	}
+	if sw["count"] != "" {
+		n, err := strconv.Atoi(sw["count"])
+		if err != nil {
+			return fmt.Errorf("Invalid -count '%s'.\n", sw["count"])
+		}
+		s.Count = n
+	}
+	if sw["cat"] != "" {
+		c, err := findCategoryByPath(db, sw["cat"])
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			return fmt.Errorf("Category '%s' doesn't exist.\n", sw["cat"])
+		}
+		s.Categoryid = c.Categoryid
+	}
+	if sw["payee"] != "" {
+		id, err := createPayeeName(db, sw["payee"])
+		if err != nil {
+			return err
+		}
+		s.Payeeid = id
+	}
+	if sw["lastbizday"] != "" {
+		s.Lastbizday = true
+	}
+	if sw["nolastbizday"] != "" {
+		s.Lastbizday = false
+	}
+	return nil
+}
+
+// t income <db file> [-from <date>] [-to <date>] [-per month|quarter|year] [-by category|account]
+func cmdIncome(db *sql.DB, sw map[string]string, args []string) error {
+	repcur, err := findReportCurrency(db, sw["c"])
+	if err != nil {
+		return err
+	}
+	unit, err := parsePeriodUnit(sw["per"])
+	if err != nil {
+		return fmt.Errorf("%s.\n", err)
+	}
+	var byaccount bool
+	switch sw["by"] {
+	case "", "category":
+	case "account":
+		byaccount = true
+	default:
+		return fmt.Errorf("Invalid -by '%s', use category or account.\n", sw["by"])
+	}
+	enddt := sw["to"]
+	if enddt == "" {
+		enddt = today()
+	}
+	if !isDate(enddt) {
+		return fmt.Errorf("Invalid date '%s', use YYYY-MM-DD.\n", enddt)
+	}
+	startdt := sw["from"]
+	if startdt == "" {
+		startdt = enddt[:4] + "-01-01"
+	}
+	if !isDate(startdt) {
+		return fmt.Errorf("Invalid date '%s', use YYYY-MM-DD.\n", startdt)
+	}
+	return printIncomeReport(os.Stdout, db, repcur, startdt, enddt, unit, byaccount)
+}
+
+// t networth <db file> [-from <date>] [-to <date>]
+func cmdNetWorth(db *sql.DB, sw map[string]string, args []string) error {
+	repcur, err := findReportCurrency(db, sw["c"])
+	if err != nil {
+		return err
+	}
+	enddt := sw["to"]
+	if enddt == "" {
+		enddt = today()
+	}
+	if !isDate(enddt) {
+		return fmt.Errorf("Invalid date '%s', use YYYY-MM-DD.\n", enddt)
+	}
+	startdt := sw["from"]
+	if startdt == "" {
+		startdt = addMonth(enddt[:7], -11) + "-01"
+	}
+	if !isDate(startdt) {
+		return fmt.Errorf("Invalid date '%s', use YYYY-MM-DD.\n", startdt)
+	}
+	return printNetWorthReport(os.Stdout, db, repcur, startdt, enddt)
+}
+
+// t import-csv <db file> <account code> <csv file> [mapping options] [--save]
+func cmdImportCSV(db *sql.DB, sw map[string]string, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("Specify account code and CSV file.\n")
+	}
+	a, err := findAccountArg(db, args[0])
+	if err != nil {
+		return err
+	}
+	m, err := findCSVMapping(db, a.Accountid)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		m = defaultCSVMapping(a.Accountid)
+	}
+
+	// Options override the saved mapping.
+	if sw["amt"] != "" || sw["debit"] != "" || sw["credit"] != "" {
+		m.Amtcol, m.Debitcol, m.Creditcol = sw["amt"], sw["debit"], sw["credit"]
+	}
+	opts := map[string]*string{
+		"date":    &m.Datecol,
+		"ref":     &m.Refcol,
+		"desc":    &m.Desccol,
+		"datefmt": &m.Dateformat,
+		"decimal": &m.Decimalsep,
+		"delim":   &m.Delimiter,
+	}
+	for k, p := range opts {
+		if sw[k] != "" {
+			*p = sw[k]
+		}
+	}
+	if sw["skip"] != "" {
+		m.Skip, err = strconv.Atoi(sw["skip"])
+		if err != nil {
+			return fmt.Errorf("Invalid -skip '%s'.\n", sw["skip"])
+		}
+	}
+	if sw["header"] != "" {
+		m.Header = true
+	}
+	if sw["noheader"] != "" {
+		m.Header = false
+	}
+
+	f, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, err := importCSV(db, m, f)
+	if err != nil {
+		return fmt.Errorf("Error importing '%s' (%s)\n", args[1], err)
+	}
+	fmt.Printf("Added %d transaction(s) to %s.\n", n, a.Code)
+
+	if sw["save"] != "" {
+		err := saveCSVMapping(db, m)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Saved CSV mapping for %s.\n", a.Code)
+	}
+	return nil
+}
+
+// t import-ofx <db file> <account code> <ofx or qfx file> [-acctid <id>]
+func cmdImportOFX(db *sql.DB, sw map[string]string, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("Specify account code and OFX file.\n")
+	}
+	a, err := findAccountArg(db, args[0])
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	added, skipped, err := importOFX(db, a.Accountid, f, sw["acctid"])
+	if err != nil {
+		return fmt.Errorf("Error importing '%s' (%s)\n", args[1], err)
+	}
+	fmt.Printf("Added %d transaction(s) to %s, skipped %d imported before.\n", added, a.Code, skipped)
+	return nil
+}
+
+// t import-qif <db file> <account code> <qif file> [--dmy]
+func cmdImportQIF(db *sql.DB, sw map[string]string, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("Specify account code and QIF file.\n")
+	}
+	a, err := findAccountArg(db, args[0])
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	added, skipped, err := importQIF(db, a.Accountid, f, sw["dmy"] != "")
+	if err != nil {
+		return fmt.Errorf("Error importing '%s' (%s)\n", args[1], err)
+	}
+	fmt.Printf("Added %d transaction(s) to %s, skipped %d record(s).\n", added, a.Code, skipped)
+	return nil
+}
+
+// t export-qif <db file> <account code> [qif file] [--dmy]
+func cmdExportQIF(db *sql.DB, sw map[string]string, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("Specify account code.\n")
+	}
+	a, err := findAccountArg(db, args[0])
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return exportQIF(os.Stdout, db, a.Accountid, sw["dmy"] != "")
+	}
+	if fileExists(args[1]) {
+		return fmt.Errorf("File '%s' already exists.\n", args[1])
+	}
+	f, err := os.Create(args[1])
+	if err != nil {
+		return err
+	}
+	err = exportQIF(f, db, a.Accountid, sw["dmy"] != "")
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func listContains(ss []string, v string) bool {
 	for _, s := range ss {
 		if v == s {
@@ -133,55 +761,47 @@ func pollEvents(chev chan tb.Event) {
 	}
 }
 
-func createTables(newfile string) {
+// Create new db file with the current schema and some starting data.
+func createTables(newfile string) error {
 	if fileExists(newfile) {
-		s := fmt.Sprintf("File '%s' already exists. Can't initialize it.\n", newfile)
-		fmt.Printf(s)
-		os.Exit(1)
+		return fmt.Errorf("File '%s' already exists. Can't initialize it.\n", newfile)
 	}
 
-	db, err := sql.Open("sqlite3", newfile)
+	db, err := openDB(newfile)
 	if err != nil {
-		fmt.Printf("Error opening '%s' (%s)\n", newfile, err)
-		os.Exit(1)
+		return fmt.Errorf("Error creating '%s' (%s)\n", newfile, err)
 	}
+	defer db.Close()
 
-	ss := []string{
-		"CREATE TABLE currency (currency_id INTEGER PRIMARY KEY NOT NULL, name TEXT, usdrate REAL);",
-		"CREATE TABLE account (account_id INTEGER PRIMARY KEY NOT NULL, code TEXT, name TEXT, accounttype INTEGER, currency_id INTEGER);",
-		"CREATE TABLE trans (trans_id INTEGER PRIMARY KEY NOT NULL, account_id INTEGER, date TEXT, ref TEXT, desc TEXT, amt REAL);",
-	}
+	initTestData(db)
+	return nil
+}
 
-	tx, err := db.Begin()
-	if err != nil {
-		log.Printf("DB error (%s)\n", err)
-		os.Exit(1)
+// Return currency named name, or USD if name is blank.
+func findReportCurrency(db *sql.DB, name string) (*Currency, error) {
+	if name == "" {
+		name = "USD"
 	}
-	for _, s := range ss {
-		_, err := txexec(tx, s)
-		if err != nil {
-			tx.Rollback()
-			log.Printf("DB error (%s)\n", err)
-			os.Exit(1)
-		}
-	}
-	err = tx.Commit()
+	c, err := findCurrencyByName(db, name)
 	if err != nil {
-		log.Printf("DB error (%s)\n", err)
-		os.Exit(1)
+		return nil, err
 	}
-
-	initTestData(db)
+	if c == nil {
+		return nil, fmt.Errorf("Currency '%s' doesn't exist.\n", name)
+	}
+	return c, nil
 }
 
 func initTestData(db *sql.DB) {
 	c1 := Currency{
-		Name:    "USD",
-		Usdrate: 1.0,
+		Name:     "USD",
+		Usdrate:  1.0,
+		Decimals: 2,
 	}
 	c2 := Currency{
-		Name:    "PHP",
-		Usdrate: 48.0,
+		Name:     "PHP",
+		Usdrate:  48.0,
+		Decimals: 2,
 	}
 	usdid, err := createCurrency(db, &c1)
 	if err != nil {
@@ -192,23 +812,28 @@ func initTestData(db *sql.DB) {
 		panic(err)
 	}
 
+	bank, err := findAccountTypeByName(db, "Bank")
+	if err != nil {
+		panic(err)
+	}
+
 	a1 := Account{
-		Code:        "bpichecking",
-		Name:        "BPI Checking Account",
-		AccountType: BankAccount,
-		Currencyid:  phpid,
+		Code:          "bpichecking",
+		Name:          "BPI Checking Account",
+		Accounttypeid: bank.Accounttypeid,
+		Currencyid:    phpid,
 	}
 	a2 := Account{
-		Code:        "bpisavings",
-		Name:        "BPI Savings Account",
-		AccountType: BankAccount,
-		Currencyid:  phpid,
+		Code:          "bpisavings",
+		Name:          "BPI Savings Account",
+		Accounttypeid: bank.Accounttypeid,
+		Currencyid:    phpid,
 	}
 	a3 := Account{
-		Code:        "bpiusd",
-		Name:        "BPI USD",
-		AccountType: BankAccount,
-		Currencyid:  usdid,
+		Code:          "bpiusd",
+		Name:          "BPI USD",
+		Accounttypeid: bank.Accounttypeid,
+		Currencyid:    usdid,
 	}
 	_, err = createAccount(db, &a1)
 	if err != nil {
@@ -229,7 +854,9 @@ func parseArgs(args []string) (map[string]string, []string) {
 	parms := []string{}
 
 	standaloneSwitches := []string{}
-	definitionSwitches := []string{"i"}
+	definitionSwitches := []string{"i", "c", "d", "from", "to", "per", "by",
+		"date", "ref", "desc", "amt", "debit", "credit", "datefmt", "decimal", "delim", "skip",
+		"every", "count", "cat", "payee", "acctid"}
 	fNoMoreSwitches := false
 	curKey := ""
 
@@ -240,6 +867,10 @@ func parseArgs(args []string) (map[string]string, []string) {
 		} else if arg == "--" {
 			// "--" means no more switches to come
 			fNoMoreSwitches = true
+		} else if curKey != "" && len(arg) > 1 && arg[0] == '-' && (arg[1] >= '0' && arg[1] <= '9' || arg[1] == '.') {
+			// -amt -12.50
+			switches[curKey] = arg
+			curKey = ""
 		} else if strings.HasPrefix(arg, "--") {
 			switches[arg[2:]] = "y"
 			curKey = ""
@@ -101,6 +101,15 @@ func (w *TxEntry) HandleEvent(e tb.Event) bool {
 			w.Props.EventCB(&we)
 		}
 		return true
+	case tb.KeyEnter:
+		if w.Props.EventCB != nil {
+			we := TxEvent{
+				Code:   TxEventEnter,
+				Detail: w.Text,
+			}
+			w.Props.EventCB(&we)
+		}
+		return true
 	case tb.KeyArrowLeft:
 		w.Cur.X--
 		w.adjustCur()
@@ -2,6 +2,7 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
 
 	_ "github.com/mattn/go-sqlite3"
 	tb "github.com/nsf/termbox-go"
@@ -9,65 +10,240 @@ import (
 
 type WAccounts struct {
 	db            *sql.DB
+	repcur        *Currency
+	asof          string // balances as of end of this day, blank for now
 	Rect          TxRect
 	Clr           TxColor
 	Cb            TxEventCB
+	mode          int
 	tblAccounts   *TxTable
 	tblSelAccount *TxTable
+	selAccountid  int64
+	wReconcile    *WReconcile
+	wBudget       *WBudget
+	wIncome       *WIncome
+	tblTotals     *TxTable
+	entAsOf       *TxLabelEntry
 }
 
 const (
 	List int = iota
 	ItemView
 	ItemEdit
+	Totals
 )
 
-func NewWAccounts(db *sql.DB, rect TxRect, clr TxColor, cb TxEventCB) *WAccounts {
+// repcur is the reporting currency used for the net worth total.
+func NewWAccounts(db *sql.DB, repcur *Currency, rect TxRect, clr TxColor, cb TxEventCB) *WAccounts {
 	initColor(&clr)
 
 	w := WAccounts{
-		db:   db,
-		Rect: rect,
-		Clr:  clr,
-		Cb:   cb,
+		db:     db,
+		repcur: repcur,
+		Rect:   rect,
+		Clr:    clr,
+		Cb:     cb,
 	}
 	r := TxRect{0, 0, rect.W, rect.H}
-	tblAccounts := createAccountsTable(db, r, clr, w.onAccountsEvent)
+	tblAccounts := createAccountsTable(db, repcur, "", r, clr, w.onAccountsEvent)
 
+	w.mode = List
 	w.tblAccounts = tblAccounts
 	w.tblSelAccount = nil
 	return &w
 }
 
-func createAccountsTable(db *sql.DB, r TxRect, clr TxColor, cb TxEventCB) *TxTable {
+func createAccountsTable(db *sql.DB, repcur *Currency, asof string, r TxRect, clr TxColor, cb TxEventCB) *TxTable {
 	props := &TxProps{r, TxMargin1, clr, cb, 0}
 	cols := []*TxCellSetting{
-		{"%s", 0, 40, clr, 0},
-		{"%7.2f", 40, 12, clr, 0},
+		{"%s", 0, 30, clr, 0},
+		{"%s", 31, 12, clr, 0},
+		{"%s", 44, 4, clr, 0},
+		{"%14s", 49, 14, clr, 0},
 	}
-	hh := []string{"Name", "Balance"}
-	rows := queryAccountRows(db)
+	hh := accountsHeadings(asof)
+	rows := queryAccountRows(db, repcur, asof)
 	return NewTxTable(props, clr, cols, hh, rows)
 }
 
-func queryAccountRows(db *sql.DB) []*TxTableRow {
-	aa, err := findAccounts(db, " 1=1 ORDER BY accounttype, name")
+// Balance heading shows the as-of date if there is one.
+func accountsHeadings(asof string) []string {
+	balheading := "Balance"
+	if asof != "" {
+		balheading = "Bal " + asof
+	}
+	return []string{"Name", "Type", "Cur", fmt.Sprintf("%14s", balheading)}
+}
+
+// One row per active account followed by a net worth row totalling all
+// balances in currency repcur. Stock accounts show market value.
+// Balances are as of the end of day asof, or current if asof is blank.
+func queryAccountRows(db *sql.DB, repcur *Currency, asof string) []*TxTableRow {
+	aa, err := findAccounts(db, &AccountFilter{Active: FilterTrue, Order: AccountOrderType})
 	if err != nil {
 		aa = []*Account{}
 	}
+	tt, err := findAccountTypes(db)
+	if err != nil {
+		tt = []*AccountType{}
+	}
+	types := map[int64]*AccountType{}
+	for _, at := range tt {
+		types[at.Accounttypeid] = at
+	}
+
+	cv, convErr := newConverter(db)
 
 	var rows []*TxTableRow
+	networth := Money{0, repcur}
+	complete := true
 	for _, a := range aa {
-		bal := balAccount(db, a.Accountid)
-		cells := []TxCell{a.Name, bal}
+		at := types[a.Accounttypeid]
+		typename := ""
+		if at != nil {
+			typename = at.Name
+		}
+		bal := valAccount(db, a.Accountid, asof)
+		cells := []TxCell{a.Name, typename, bal.CurName(), bal}
 		rows = append(rows, &TxTableRow{a.Accountid, a.Code, cells})
+
+		// Income, expense and equity accounts aren't part of net worth.
+		if at != nil && at.Isnominal {
+			continue
+		}
+		if convErr != nil {
+			complete = false
+			continue
+		}
+		cbal, err := cv.ConvertAsOf(bal, repcur, asof)
+		if err != nil {
+			complete = false
+			continue
+		}
+		networth = networth.Add(cbal)
+	}
+
+	// Net worth leaves out balances that couldn't be converted.
+	label := "Net Worth"
+	if !complete {
+		label = "Net Worth (incomplete)"
+	}
+	cells := []TxCell{label, "", repcur.Name, networth}
+	rows = append(rows, &TxTableRow{0, "", cells})
+	return rows
+}
+
+// Account register: transactions with running balance. Column C shows
+// whether a transaction is cleared (c) or reconciled (R).
+func createRegisterTable(db *sql.DB, accountid int64, r TxRect, clr TxColor, cb TxEventCB) *TxTable {
+	props := &TxProps{r, TxMargin1, clr, cb, 0}
+	cols := []*TxCellSetting{
+		{"%s", 0, 10, clr, 0},
+		{"%s", 11, 1, clr, 0},
+		{"%s", 13, 8, clr, 0},
+		{"%s", 22, 27, clr, 0},
+		{"%13s", 50, 13, clr, 0},
+		{"%14s", 64, 14, clr, 0},
+	}
+	hh := []string{"Date", "C", "Ref", "Description", "       Amount", "       Balance"}
+	rows := queryRegisterRows(db, accountid)
+	tbl := NewTxTable(props, clr, cols, hh, rows)
+
+	// Start at the most recent transaction.
+	if len(rows) > 0 {
+		tbl.Sel = len(rows) - 1
+		tbl.adjustScroll()
+	}
+	return tbl
+}
+
+func queryRegisterRows(db *sql.DB, accountid int64) []*TxTableRow {
+	ee, err := findRegister(db, accountid)
+	if err != nil {
+		ee = []*RegisterEntry{}
+	}
+	var rows []*TxTableRow
+	for _, e := range ee {
+		t := e.Trans
+		cells := []TxCell{t.Date, t.Status.Mark(), t.Ref, t.Desc, Money{t.Amt, e.Bal.Cur}, e.Bal}
+		rows = append(rows, &TxTableRow{t.Transid, "", cells})
 	}
 	return rows
 }
 
+// Totals by category up to asof, in currency repcur.
+func createCategoryTotalsTable(db *sql.DB, repcur *Currency, asof string, r TxRect, clr TxColor, cb TxEventCB) *TxTable {
+	props := &TxProps{r, TxMargin1, clr, cb, 0}
+	cols := []*TxCellSetting{
+		{"%s", 0, 40, clr, 0},
+		{"%14s", 41, 14, clr, 0},
+	}
+	hh := []string{"Category", fmt.Sprintf("%14s", "Amount "+repcur.Name)}
+	ctt, err := findCategoryTotals(db, repcur, "", asof)
+	if err != nil {
+		ctt = []*CategoryTotal{}
+	}
+	var rows []*TxTableRow
+	tot := Money{0, repcur}
+	for _, ct := range ctt {
+		cells := []TxCell{categoryLabel(ct.Category), ct.Amt}
+		rows = append(rows, &TxTableRow{ct.Category.Categoryid, ct.Category.Path, cells})
+		if ct.Category.Parentid == 0 {
+			tot = tot.Add(ct.Amt)
+		}
+	}
+	rows = append(rows, &TxTableRow{0, "", []TxCell{"Total", tot}})
+	return NewTxTable(props, clr, cols, hh, rows)
+}
+
+// Totals by payee up to asof, in currency repcur.
+func createPayeeTotalsTable(db *sql.DB, repcur *Currency, asof string, r TxRect, clr TxColor, cb TxEventCB) *TxTable {
+	props := &TxProps{r, TxMargin1, clr, cb, 0}
+	cols := []*TxCellSetting{
+		{"%s", 0, 40, clr, 0},
+		{"%14s", 41, 14, clr, 0},
+	}
+	hh := []string{"Payee", fmt.Sprintf("%14s", "Amount "+repcur.Name)}
+	ptt, err := findPayeeTotals(db, repcur, "", asof)
+	if err != nil {
+		ptt = []*PayeeTotal{}
+	}
+	var rows []*TxTableRow
+	tot := Money{0, repcur}
+	for _, pt := range ptt {
+		cells := []TxCell{pt.Payee.Name, pt.Amt}
+		rows = append(rows, &TxTableRow{pt.Payee.Payeeid, pt.Payee.Name, cells})
+		tot = tot.Add(pt.Amt)
+	}
+	rows = append(rows, &TxTableRow{0, "", []TxCell{"Total", tot}})
+	return NewTxTable(props, clr, cols, hh, rows)
+}
+
+// Show balances as of the end of day asof (YYYY-MM-DD), blank for current.
+func (w *WAccounts) SetAsOf(asof string) {
+	w.asof = asof
+	w.tblAccounts.Headings = accountsHeadings(asof)
+	w.tblAccounts.SetRows(queryAccountRows(w.db, w.repcur, asof))
+}
+
 func (w *WAccounts) Draw() {
 	clearRect(w.Rect, w.Clr.Bg)
-	w.tblAccounts.Draw()
+	if w.wReconcile != nil {
+		w.wReconcile.Draw()
+	} else if w.wBudget != nil {
+		w.wBudget.Draw()
+	} else if w.wIncome != nil {
+		w.wIncome.Draw()
+	} else if w.mode == ItemView && w.tblSelAccount != nil {
+		w.tblSelAccount.Draw()
+	} else if w.mode == Totals && w.tblTotals != nil {
+		w.tblTotals.Draw()
+	} else {
+		w.tblAccounts.Draw()
+	}
+	if w.entAsOf != nil {
+		w.entAsOf.Draw()
+	}
 	tb.Flush()
 }
 
@@ -75,6 +251,40 @@ func (w *WAccounts) HandleEvent(e tb.Event) bool {
 	if e.Type != tb.EventKey {
 		return false
 	}
+	if w.entAsOf != nil {
+		return w.entAsOf.HandleEvent(e)
+	}
+	if w.wReconcile != nil {
+		return w.wReconcile.HandleEvent(e)
+	}
+	if w.wBudget != nil {
+		return w.wBudget.HandleEvent(e)
+	}
+	if w.wIncome != nil {
+		return w.wIncome.HandleEvent(e)
+	}
+	if w.mode == ItemView && w.tblSelAccount != nil {
+		if e.Ch == 'r' { // reconcile against statement
+			w.wReconcile = NewWReconcile(w.db, w.selAccountid, w.Rect, w.Clr, w.onReconcileEvent)
+			return true
+		}
+		if e.Ch == 'u' { // set a reconciled transaction back to cleared
+			item := w.tblSelAccount.SelItem()
+			if item == nil || item.Id == 0 {
+				return true
+			}
+			err := unreconcileTrans(w.db, item.Id)
+			if err != nil {
+				return true
+			}
+			w.tblSelAccount.SetRows(queryRegisterRows(w.db, w.selAccountid))
+			return true
+		}
+		return w.tblSelAccount.HandleEvent(e)
+	}
+	if w.mode == Totals && w.tblTotals != nil {
+		return w.tblTotals.HandleEvent(e)
+	}
 	if e.Ch == 0 {
 		switch e.Key {
 		case tb.KeyEnter: // view
@@ -86,15 +296,104 @@ func (w *WAccounts) HandleEvent(e tb.Event) bool {
 	switch e.Ch {
 	case 'a': // add
 		_log.Printf("add\n")
+	case 'd': // balances as of date
+		r := TxRect{1, w.Rect.H - 3, 40, 2}
+		props := &TxProps{r, TxMargin0, w.Clr, w.onAsOfEvent, 0}
+		w.entAsOf = NewTxLabelEntry(props, w.Clr, w.Clr, "As of date (YYYY-MM-DD, blank for today):", w.asof, "[0-9-]*")
+		return true
+	case 'c': // totals by category
+		r := TxRect{0, 0, w.Rect.W, w.Rect.H}
+		w.tblTotals = createCategoryTotalsTable(w.db, w.repcur, w.asof, r, w.Clr, w.onTotalsEvent)
+		w.mode = Totals
+		return true
+	case 'p': // totals by payee
+		r := TxRect{0, 0, w.Rect.W, w.Rect.H}
+		w.tblTotals = createPayeeTotalsTable(w.db, w.repcur, w.asof, r, w.Clr, w.onTotalsEvent)
+		w.mode = Totals
+		return true
+	case 'b': // monthly budget
+		month := ""
+		if w.asof != "" {
+			month = w.asof[:7]
+		}
+		r := TxRect{0, 0, w.Rect.W, w.Rect.H}
+		w.wBudget = NewWBudget(w.db, w.repcur, month, r, w.Clr, w.onBudgetEvent)
+		return true
+	case 'i': // income and expenses
+		r := TxRect{0, 0, w.Rect.W, w.Rect.H}
+		w.wIncome = NewWIncome(w.db, w.repcur, w.asof, r, w.Clr, w.onIncomeEvent)
+		return true
 	}
 	return w.tblAccounts.HandleEvent(e)
 }
 
+func (w *WAccounts) onAsOfEvent(we *TxEvent) {
+	switch we.Code {
+	case TxEventEnter:
+		asof, _ := we.Detail.(string)
+		if asof != "" && !isDate(asof) {
+			return
+		}
+		w.SetAsOf(asof)
+		w.entAsOf = nil
+	case TxEventEsc:
+		w.entAsOf = nil
+	}
+}
+
 func (w *WAccounts) onAccountsEvent(we *TxEvent) {
 	switch we.Code {
 	case TxEventEnter:
 		_log.Printf("account enter, id: %d, alias: %s, display: %s\n", we.Item.Id, we.Item.Alias, we.Item.Display)
+		// Net worth row has no account.
+		if we.Item.Id == 0 {
+			return
+		}
+		r := TxRect{0, 0, w.Rect.W, w.Rect.H}
+		w.tblSelAccount = createRegisterTable(w.db, we.Item.Id, r, w.Clr, w.onRegisterEvent)
+		w.selAccountid = we.Item.Id
+		w.mode = ItemView
 	case TxEventEsc:
 	case TxEventSel:
 	}
 }
+
+func (w *WAccounts) onRegisterEvent(we *TxEvent) {
+	switch we.Code {
+	case TxEventEsc:
+		w.tblSelAccount = nil
+		w.mode = List
+	}
+}
+
+func (w *WAccounts) onReconcileEvent(we *TxEvent) {
+	switch we.Code {
+	case TxEventEsc:
+		w.wReconcile = nil
+		if w.tblSelAccount != nil {
+			w.tblSelAccount.SetRows(queryRegisterRows(w.db, w.selAccountid))
+		}
+	}
+}
+
+func (w *WAccounts) onTotalsEvent(we *TxEvent) {
+	switch we.Code {
+	case TxEventEsc:
+		w.tblTotals = nil
+		w.mode = List
+	}
+}
+
+func (w *WAccounts) onBudgetEvent(we *TxEvent) {
+	switch we.Code {
+	case TxEventEsc:
+		w.wBudget = nil
+	}
+}
+
+func (w *WAccounts) onIncomeEvent(we *TxEvent) {
+	switch we.Code {
+	case TxEventEsc:
+		w.wIncome = nil
+	}
+}
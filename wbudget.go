@@ -0,0 +1,258 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	tb "github.com/nsf/termbox-go"
+)
+
+// Monthly budget by category: every category with its budget for the month,
+// amount carried over, actual spending and what remains.
+// Posts TxEventEsc to cb when closed.
+type WBudget struct {
+	db        *sql.DB
+	repcur    *Currency
+	month     string
+	Rect      TxRect
+	Clr       TxColor
+	Cb        TxEventCB
+	tbl       *TxTable
+	ent       *TxLabelEntry
+	lblStatus *TxLabel
+	msg       string
+}
+
+// New budgets are in currency repcur.
+func NewWBudget(db *sql.DB, repcur *Currency, month string, rect TxRect, clr TxColor, cb TxEventCB) *WBudget {
+	initColor(&clr)
+	if !isMonth(month) {
+		month = time.Now().Format(monthFormat)
+	}
+
+	w := WBudget{
+		db:     db,
+		repcur: repcur,
+		month:  month,
+		Rect:   rect,
+		Clr:    clr,
+		Cb:     cb,
+	}
+	r := TxRect{rect.X, rect.Y, rect.W, rect.H - 3}
+	props := &TxProps{r, TxMargin1, clr, w.onTableEvent, 0}
+	cols := []*TxCellSetting{
+		{"%s", 0, 28, clr, 0},
+		{"%s", 29, 1, clr, 0},
+		{"%11s", 31, 11, clr, 0},
+		{"%11s", 43, 11, clr, 0},
+		{"%11s", 55, 11, clr, 0},
+		{"%11s", 67, 11, clr, 0},
+	}
+	hh := []string{"Category", "R", "   Budgeted", "    Carried", "     Actual", "  Remaining"}
+	w.tbl = NewTxTable(props, clr, cols, hh, w.queryRows())
+
+	r = TxRect{rect.X + 1, rect.Y + rect.H - 3, rect.W - 2, 1}
+	w.lblStatus = NewTxLabel(&TxProps{r, TxMargin0, clr, nil, 0}, "")
+	w.updateStatus()
+	return &w
+}
+
+// One row per category. Categories without a budget for the month are
+// listed with blank amounts so that a budget can be set on them.
+func (w *WBudget) queryRows() []*TxTableRow {
+	cc, err := findCategories(w.db)
+	if err != nil {
+		cc = []*Category{}
+	}
+	bss, err := findBudgetStatus(w.db, w.month)
+	if err != nil {
+		w.msg = err.Error()
+		bss = []*BudgetStatus{}
+	}
+	byid := map[int64]*BudgetStatus{}
+	for _, bs := range bss {
+		byid[bs.Category.Categoryid] = bs
+	}
+
+	var rows []*TxTableRow
+	for _, c := range cc {
+		cells := []TxCell{categoryLabel(c), "", "", "", "", ""}
+		if bs, ok := byid[c.Categoryid]; ok {
+			rollover := ""
+			if bs.Budget.Rollover {
+				rollover = "R"
+			}
+			cells = []TxCell{categoryLabel(c), rollover, bs.Budgeted, bs.Carried, bs.Actual, bs.Remaining}
+		}
+		rows = append(rows, &TxTableRow{c.Categoryid, c.Path, cells})
+	}
+	return rows
+}
+
+func (w *WBudget) refresh() {
+	w.tbl.SetRows(w.queryRows())
+	w.updateStatus()
+}
+
+func (w *WBudget) updateStatus() {
+	s := fmt.Sprintf("%s  </>: month  e: set amount  r: rollover  c: copy from last month", w.month)
+	if w.msg != "" {
+		s = w.month + "  " + w.msg
+	}
+	w.lblStatus.SetText(s)
+}
+
+func (w *WBudget) onTableEvent(we *TxEvent) {
+	switch we.Code {
+	case TxEventEsc:
+		if w.Cb != nil {
+			w.Cb(&TxEvent{Code: TxEventEsc})
+		}
+	}
+}
+
+// Prompt for the selected category's budget amount. A blank amount removes
+// the budget.
+func (w *WBudget) editSel() {
+	item := w.tbl.SelItem()
+	if item == nil {
+		return
+	}
+	text := ""
+	b, err := findCategoryBudget(w.db, item.Id, w.month)
+	if err == nil && b != nil {
+		text = Money{b.Amt, w.budgetCurrency(b)}.String()
+	}
+	r := TxRect{w.Rect.X + 1, w.Rect.Y + w.Rect.H - 3, 40, 2}
+	props := &TxProps{r, TxMargin0, w.Clr, w.onAmtEvent, 0}
+	label := fmt.Sprintf("Budget for %s (blank for none):", item.Alias)
+	w.ent = NewTxLabelEntry(props, w.Clr, w.Clr, label, text, "[0-9.,]*")
+}
+
+func (w *WBudget) onAmtEvent(we *TxEvent) {
+	switch we.Code {
+	case TxEventEnter:
+		item := w.tbl.SelItem()
+		if item == nil {
+			w.ent = nil
+			return
+		}
+		s, _ := we.Detail.(string)
+		b, err := findCategoryBudget(w.db, item.Id, w.month)
+		if err != nil {
+			w.msg = err.Error()
+			w.ent = nil
+			w.updateStatus()
+			return
+		}
+		if s == "" {
+			if b != nil {
+				err = delBudget(w.db, b.Budgetid)
+			}
+		} else {
+			amt, perr := parseMoney(s, w.budgetCurrency(b))
+			if perr != nil {
+				return
+			}
+			if b == nil {
+				b = &Budget{Categoryid: item.Id, Month: w.month, Currencyid: w.repcur.Currencyid}
+			}
+			b.Amt = amt.Units
+			_, err = createBudget(w.db, b)
+		}
+		if err != nil {
+			w.msg = err.Error()
+		}
+		w.ent = nil
+		w.refresh()
+	case TxEventEsc:
+		w.ent = nil
+	}
+}
+
+// Currency of budget b, or repcur for a new budget.
+func (w *WBudget) budgetCurrency(b *Budget) *Currency {
+	if b == nil {
+		return w.repcur
+	}
+	cur, err := findCurrency(w.db, b.Currencyid)
+	if err != nil || cur == nil {
+		return w.repcur
+	}
+	return cur
+}
+
+// Turn rollover of the selected category's budget on or off.
+func (w *WBudget) toggleRollover() {
+	item := w.tbl.SelItem()
+	if item == nil {
+		return
+	}
+	b, err := findCategoryBudget(w.db, item.Id, w.month)
+	if err != nil || b == nil {
+		return
+	}
+	b.Rollover = !b.Rollover
+	err = editBudget(w.db, b)
+	if err != nil {
+		w.msg = err.Error()
+	}
+	w.refresh()
+}
+
+func (w *WBudget) copyForward() {
+	n, err := copyBudgets(w.db, addMonth(w.month, -1), w.month)
+	if err != nil {
+		w.msg = err.Error()
+	} else {
+		w.msg = fmt.Sprintf("Copied %d budget(s) from %s", n, addMonth(w.month, -1))
+	}
+	w.refresh()
+}
+
+func (w *WBudget) SetMonth(month string) {
+	w.month = month
+	w.refresh()
+}
+
+func (w *WBudget) Draw() {
+	clearRect(w.Rect, w.Clr.Bg)
+	w.tbl.Draw()
+	if w.ent != nil {
+		w.ent.Draw()
+	} else {
+		w.lblStatus.Draw()
+	}
+}
+
+func (w *WBudget) HandleEvent(e tb.Event) bool {
+	if e.Type != tb.EventKey {
+		return false
+	}
+	if w.ent != nil {
+		return w.ent.HandleEvent(e)
+	}
+	w.msg = ""
+	switch e.Ch {
+	case '<':
+		w.SetMonth(addMonth(w.month, -1))
+		return true
+	case '>':
+		w.SetMonth(addMonth(w.month, 1))
+		return true
+	case 'e':
+		w.editSel()
+		return true
+	case 'r':
+		w.toggleRollover()
+		return true
+	case 'c':
+		w.copyForward()
+		return true
+	}
+	handled := w.tbl.HandleEvent(e)
+	w.updateStatus()
+	return handled
+}
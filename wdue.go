@@ -0,0 +1,109 @@
+package main
+
+import (
+	"database/sql"
+
+	_ "github.com/mattn/go-sqlite3"
+	tb "github.com/nsf/termbox-go"
+)
+
+// Scheduled transactions due as of today. 'p' posts them all, Esc skips
+// them for now. Posts TxEventEsc to cb when done.
+type WDue struct {
+	db      *sql.DB
+	Rect    TxRect
+	Clr     TxColor
+	Cb      TxEventCB
+	tblDue  *TxTable
+	lblHelp *TxLabel
+	asof    string
+	ndue    int
+}
+
+func NewWDue(db *sql.DB, rect TxRect, clr TxColor, cb TxEventCB) *WDue {
+	initColor(&clr)
+
+	w := WDue{
+		db:   db,
+		Rect: rect,
+		Clr:  clr,
+		Cb:   cb,
+		asof: today(),
+	}
+	r := TxRect{rect.X, rect.Y, rect.W, rect.H - 2}
+	props := &TxProps{r, TxMargin1, clr, w.onDueEvent, 0}
+	cols := []*TxCellSetting{
+		{"%s", 0, 10, clr, 0},
+		{"%s", 11, 24, clr, 0},
+		{"%s", 36, 26, clr, 0},
+		{"%14s", 63, 14, clr, 0},
+	}
+	hh := []string{"Date", "Account", "Description", "        Amount"}
+	rows := w.queryDueRows()
+	w.tblDue = NewTxTable(props, clr, cols, hh, rows)
+
+	r = TxRect{rect.X + 1, rect.Y + rect.H - 2, rect.W - 2, 1}
+	w.lblHelp = NewTxLabel(&TxProps{r, TxMargin0, clr, nil, 0}, "p: post all due transactions  Esc: skip")
+	return &w
+}
+
+func (w *WDue) queryDueRows() []*TxTableRow {
+	dd, err := findDue(w.db, w.asof)
+	if err != nil {
+		dd = []*Due{}
+	}
+	w.ndue = len(dd)
+	var rows []*TxTableRow
+	for _, d := range dd {
+		s := d.Schedule
+		a, _ := findAccount(w.db, s.Accountid)
+		cur, _ := findAccountCurrency(w.db, s.Accountid)
+		name := ""
+		if a != nil {
+			name = a.Name
+		}
+		cells := []TxCell{d.Date, name, s.Desc, Money{s.Amt, cur}}
+		rows = append(rows, &TxTableRow{s.Scheduleid, "", cells})
+	}
+	return rows
+}
+
+// Number of occurrences due.
+func (w *WDue) Len() int {
+	return w.ndue
+}
+
+func (w *WDue) Draw() {
+	clearRect(w.Rect, w.Clr.Bg)
+	w.tblDue.Draw()
+	w.lblHelp.Draw()
+}
+
+func (w *WDue) HandleEvent(e tb.Event) bool {
+	if e.Type != tb.EventKey {
+		return false
+	}
+	if e.Ch == 'p' {
+		_, err := postDue(w.db, w.asof)
+		if err != nil {
+			w.lblHelp.SetText(err.Error())
+			return true
+		}
+		w.done()
+		return true
+	}
+	return w.tblDue.HandleEvent(e)
+}
+
+func (w *WDue) onDueEvent(we *TxEvent) {
+	switch we.Code {
+	case TxEventEsc:
+		w.done()
+	}
+}
+
+func (w *WDue) done() {
+	if w.Cb != nil {
+		w.Cb(&TxEvent{Code: TxEventEsc})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	tb "github.com/nsf/termbox-go"
+)
+
+// Income and expense report for the last few months, quarters or years up
+// to an as-of date, as many as fit the width.
+// Posts TxEventEsc to cb when closed.
+type WIncome struct {
+	db        *sql.DB
+	repcur    *Currency
+	asof      string
+	unit      PeriodUnit
+	byaccount bool
+	Rect      TxRect
+	Clr       TxColor
+	Cb        TxEventCB
+	tbl       *TxTable
+	lblStatus *TxLabel
+	msg       string
+}
+
+const (
+	incomeLabelW = 24
+	incomeAmtW   = 13
+)
+
+// asof blank is today.
+func NewWIncome(db *sql.DB, repcur *Currency, asof string, rect TxRect, clr TxColor, cb TxEventCB) *WIncome {
+	initColor(&clr)
+	if asof == "" {
+		asof = today()
+	}
+
+	w := WIncome{
+		db:     db,
+		repcur: repcur,
+		asof:   asof,
+		unit:   PeriodMonth,
+		Rect:   rect,
+		Clr:    clr,
+		Cb:     cb,
+	}
+	r := TxRect{rect.X + 1, rect.Y + rect.H - 3, rect.W - 2, 1}
+	w.lblStatus = NewTxLabel(&TxProps{r, TxMargin0, clr, nil, 0}, "")
+	w.createTable()
+	return &w
+}
+
+// Number of period columns that fit beside the label and total columns.
+func (w *WIncome) nperiods() int {
+	n := (w.Rect.W - 2 - incomeLabelW - incomeAmtW - 1) / (incomeAmtW + 1)
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+func (w *WIncome) createTable() {
+	asof, _ := time.Parse(dateFormat, w.asof)
+	start := w.unit.start(asof).AddDate(0, -w.unit.months()*(w.nperiods()-1), 0)
+	rpt, err := findIncomeReport(w.db, w.repcur, start.Format(dateFormat), w.asof, w.unit, w.byaccount)
+	if err != nil {
+		w.msg = err.Error()
+		rpt = &IncomeReport{Repcur: w.repcur}
+	}
+
+	cols := []*TxCellSetting{{"%s", 0, incomeLabelW, w.Clr, 0}}
+	by := "Category"
+	if w.byaccount {
+		by = "Account"
+	}
+	hh := []string{by}
+	x := incomeLabelW + 1
+	for _, p := range rpt.Periods {
+		cols = append(cols, &TxCellSetting{fmt.Sprintf("%%%ds", incomeAmtW), x, incomeAmtW, w.Clr, 0})
+		hh = append(hh, fmt.Sprintf("%*s", incomeAmtW, p.Label))
+		x += incomeAmtW + 1
+	}
+	cols = append(cols, &TxCellSetting{fmt.Sprintf("%%%ds", incomeAmtW), x, incomeAmtW, w.Clr, 0})
+	hh = append(hh, fmt.Sprintf("%*s", incomeAmtW, "Total"))
+
+	var rows []*TxTableRow
+	addRow := func(r *IncomeRow) {
+		cells := []TxCell{incomeLabel(r)}
+		for _, m := range r.Amts {
+			cells = append(cells, m)
+		}
+		cells = append(cells, r.Total)
+		rows = append(rows, &TxTableRow{r.Id, r.Label, cells})
+	}
+	if rpt.Income != nil {
+		for _, sect := range []*IncomeSection{rpt.Income, rpt.Expenses} {
+			rows = append(rows, &TxTableRow{0, "", []TxCell{sect.Name}})
+			for _, r := range sect.Rows {
+				addRow(r)
+			}
+			addRow(sect.Subtotal)
+		}
+		addRow(rpt.Net)
+	}
+
+	r := TxRect{w.Rect.X, w.Rect.Y, w.Rect.W, w.Rect.H - 3}
+	props := &TxProps{r, TxMargin1, w.Clr, w.onTableEvent, 0}
+	w.tbl = NewTxTable(props, w.Clr, cols, hh, rows)
+	w.updateStatus()
+}
+
+func (w *WIncome) updateStatus() {
+	s := fmt.Sprintf("To %s (%s)  m/u/y: month/quarter/year  a: by account/category", w.asof, w.repcur.Name)
+	if w.msg != "" {
+		s = w.msg
+	}
+	w.lblStatus.SetText(s)
+}
+
+func (w *WIncome) onTableEvent(we *TxEvent) {
+	switch we.Code {
+	case TxEventEsc:
+		if w.Cb != nil {
+			w.Cb(&TxEvent{Code: TxEventEsc})
+		}
+	}
+}
+
+func (w *WIncome) Draw() {
+	clearRect(w.Rect, w.Clr.Bg)
+	w.tbl.Draw()
+	w.lblStatus.Draw()
+}
+
+func (w *WIncome) HandleEvent(e tb.Event) bool {
+	if e.Type != tb.EventKey {
+		return false
+	}
+	w.msg = ""
+	switch e.Ch {
+	case 'm':
+		w.unit = PeriodMonth
+	case 'u':
+		w.unit = PeriodQuarter
+	case 'y':
+		w.unit = PeriodYear
+	case 'a':
+		w.byaccount = !w.byaccount
+	default:
+		return w.tbl.HandleEvent(e)
+	}
+	w.createTable()
+	return true
+}
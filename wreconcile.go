@@ -0,0 +1,212 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+	tb "github.com/nsf/termbox-go"
+)
+
+// Reconcile an account against a bank statement: enter the statement date
+// and ending balance, tick off the transactions on the statement, then
+// finish when the difference is zero to lock them as reconciled.
+// Posts TxEventEsc to cb when done or cancelled.
+type WReconcile struct {
+	db        *sql.DB
+	accountid int64
+	cur       *Currency
+	stmtdate  string
+	endbal    Money
+	Rect      TxRect
+	Clr       TxColor
+	Cb        TxEventCB
+	ent       *TxLabelEntry
+	tbl       *TxTable
+	lblStatus *TxLabel
+	msg       string
+}
+
+func NewWReconcile(db *sql.DB, accountid int64, rect TxRect, clr TxColor, cb TxEventCB) *WReconcile {
+	initColor(&clr)
+	cur, _ := findAccountCurrency(db, accountid)
+
+	w := WReconcile{
+		db:        db,
+		accountid: accountid,
+		cur:       cur,
+		Rect:      rect,
+		Clr:       clr,
+		Cb:        cb,
+	}
+	r := TxRect{rect.X + 1, rect.Y + rect.H - 3, rect.W - 2, 1}
+	w.lblStatus = NewTxLabel(&TxProps{r, TxMargin0, clr, nil, 0}, "")
+
+	stmtdate := today()
+	last, err := findLastStatement(db, accountid)
+	if err == nil && last != nil && last.Date >= stmtdate {
+		stmtdate = last.Date
+	}
+	w.prompt("Statement end date (YYYY-MM-DD):", stmtdate, "[0-9-]*", w.onDateEvent)
+	return &w
+}
+
+func (w *WReconcile) prompt(label, text, svalidator string, cb TxEventCB) {
+	r := TxRect{w.Rect.X + 1, w.Rect.Y + w.Rect.H - 3, 40, 2}
+	props := &TxProps{r, TxMargin0, w.Clr, cb, 0}
+	w.ent = NewTxLabelEntry(props, w.Clr, w.Clr, label, text, svalidator)
+}
+
+func (w *WReconcile) onDateEvent(we *TxEvent) {
+	switch we.Code {
+	case TxEventEnter:
+		stmtdate, _ := we.Detail.(string)
+		if !isDate(stmtdate) {
+			return
+		}
+		w.stmtdate = stmtdate
+		w.prompt("Statement ending balance:", "", "[0-9.,()-]*", w.onEndbalEvent)
+	case TxEventEsc:
+		w.done()
+	}
+}
+
+func (w *WReconcile) onEndbalEvent(we *TxEvent) {
+	switch we.Code {
+	case TxEventEnter:
+		s, _ := we.Detail.(string)
+		endbal, err := parseMoney(s, w.cur)
+		if err != nil {
+			return
+		}
+		w.endbal = endbal
+		w.ent = nil
+		w.createTable()
+	case TxEventEsc:
+		w.done()
+	}
+}
+
+func (w *WReconcile) createTable() {
+	r := TxRect{w.Rect.X, w.Rect.Y, w.Rect.W, w.Rect.H - 3}
+	props := &TxProps{r, TxMargin1, w.Clr, w.onTableEvent, 0}
+	cols := []*TxCellSetting{
+		{"%s", 0, 1, w.Clr, 0},
+		{"%s", 2, 10, w.Clr, 0},
+		{"%s", 13, 8, w.Clr, 0},
+		{"%s", 22, 40, w.Clr, 0},
+		{"%14s", 63, 14, w.Clr, 0},
+	}
+	hh := []string{"C", "Date", "Ref", "Description", "        Amount"}
+	w.tbl = NewTxTable(props, w.Clr, cols, hh, w.queryRows())
+	w.updateStatus()
+}
+
+func (w *WReconcile) queryRows() []*TxTableRow {
+	tt, err := findUnreconciled(w.db, w.accountid, w.stmtdate)
+	if err != nil {
+		tt = []*Trans{}
+	}
+	var rows []*TxTableRow
+	for _, t := range tt {
+		cells := []TxCell{t.Status.Mark(), t.Date, t.Ref, t.Desc, Money{t.Amt, w.cur}}
+		rows = append(rows, &TxTableRow{t.Transid, "", cells})
+	}
+	return rows
+}
+
+func (w *WReconcile) updateStatus() {
+	cleared := balCleared(w.db, w.accountid, w.stmtdate)
+	diff := w.endbal.Sub(cleared)
+	s := fmt.Sprintf("%s  Statement %s  Cleared %s  Difference %s", w.stmtdate, w.endbal, cleared, diff)
+	if w.msg != "" {
+		s += "  " + w.msg
+	} else if diff.IsZero() {
+		s += "  f: finish"
+	}
+	w.lblStatus.SetText(s)
+}
+
+func (w *WReconcile) onTableEvent(we *TxEvent) {
+	switch we.Code {
+	case TxEventEsc:
+		w.done()
+	}
+}
+
+func (w *WReconcile) done() {
+	w.ent = nil
+	w.tbl = nil
+	if w.Cb != nil {
+		w.Cb(&TxEvent{Code: TxEventEsc})
+	}
+}
+
+// Tick or untick the selected transaction.
+func (w *WReconcile) toggleSel() {
+	item := w.tbl.SelItem()
+	if item == nil {
+		return
+	}
+	t, err := findTrans(w.db, item.Id)
+	if err != nil || t == nil {
+		return
+	}
+	status := StatusCleared
+	if t.Status == StatusCleared {
+		status = StatusUncleared
+	}
+	err = setTransStatus(w.db, t.Transid, status)
+	if err != nil {
+		w.msg = err.Error()
+	}
+	w.tbl.SetRows(w.queryRows())
+	w.updateStatus()
+}
+
+func (w *WReconcile) finish() {
+	_, err := finishReconcile(w.db, w.accountid, w.stmtdate, w.endbal.Units)
+	if err != nil {
+		w.msg = err.Error()
+		w.updateStatus()
+		return
+	}
+	w.done()
+}
+
+func (w *WReconcile) Draw() {
+	clearRect(w.Rect, w.Clr.Bg)
+	if w.tbl != nil {
+		w.tbl.Draw()
+		w.lblStatus.Draw()
+	}
+	if w.ent != nil {
+		w.ent.Draw()
+	}
+}
+
+func (w *WReconcile) HandleEvent(e tb.Event) bool {
+	if e.Type != tb.EventKey {
+		return false
+	}
+	if w.ent != nil {
+		return w.ent.HandleEvent(e)
+	}
+	if w.tbl == nil {
+		return false
+	}
+	w.msg = ""
+	if e.Ch == 0 && e.Key == tb.KeySpace {
+		w.toggleSel()
+		return true
+	}
+	if e.Ch == 'f' {
+		w.finish()
+		return true
+	}
+	handled := w.tbl.HandleEvent(e)
+	if w.tbl != nil {
+		w.updateStatus()
+	}
+	return handled
+}